@@ -0,0 +1,381 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// maxDocumentSize of fetched remote documents
+const maxDocumentSize = 1 << 20
+
+// Service represents moc as a single ActivityPub actor
+type Service struct {
+	BaseURL  string
+	Username string
+
+	// AllowPrivate also allows plain http and private addresses, only for tests
+	AllowPrivate bool
+
+	key    *rsa.PrivateKey
+	client *http.Client
+}
+
+// NewService loads the actor key and creates a new service
+func NewService(config *config.Config) (*Service, error) {
+	key, err := LoadKey(config.ActivityPub.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Service{
+		BaseURL:      strings.TrimSuffix(config.ActivityPub.BaseURL, "/"),
+		Username:     config.ActivityPub.Username,
+		AllowPrivate: config.ActivityPub.AllowPrivate,
+		key:          key,
+	}
+
+	// remote ids come from unauthenticated requests, so never follow them
+	// into the local network and never through a proxy
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{Timeout: 5 * time.Second, Control: s.checkAddress}).DialContext
+
+	s.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return s.checkURL(req.URL)
+		},
+	}
+
+	return s, nil
+}
+
+// LoadKey reads a pem encoded rsa key and creates one if the file is missing
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate actor key")
+		}
+
+		data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return nil, errors.Wrap(err, "write actor key")
+		}
+
+		return key, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read actor key")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("no pem data found in %s", path)
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse actor key")
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("actor key is not a rsa key")
+	}
+
+	return rsaKey, nil
+}
+
+// ======================================
+// IDs
+// ======================================
+
+// ActorID is the url of the actor document
+func (s *Service) ActorID() string {
+	return s.BaseURL + "/ap/actor"
+}
+
+// KeyID is the url of the actor key
+func (s *Service) KeyID() string {
+	return s.ActorID() + "#main-key"
+}
+
+// FollowersID is the url of the followers collection
+func (s *Service) FollowersID() string {
+	return s.BaseURL + "/ap/followers"
+}
+
+// NoteID is the url of a message as note
+func (s *Service) NoteID(message *models.Message) string {
+	return fmt.Sprintf("%s/ap/notes/%s", s.BaseURL, message.ID)
+}
+
+// Host of the base url, used as webfinger domain
+func (s *Service) Host() string {
+	u, err := url.Parse(s.BaseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// Account is the webfinger resource of the actor
+func (s *Service) Account() string {
+	return fmt.Sprintf("acct:%s@%s", s.Username, s.Host())
+}
+
+// ======================================
+// Documents
+// ======================================
+
+// Actor document of moc
+func (s *Service) Actor() (*Actor, error) {
+	publicKey, err := EncodePublicKey(&s.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Actor{
+		Context:           Context,
+		ID:                s.ActorID(),
+		Type:              "Service",
+		PreferredUsername: s.Username,
+		Name:              "Message Operation Center",
+		Inbox:             s.BaseURL + "/ap/inbox",
+		Outbox:            s.BaseURL + "/ap/outbox",
+		Followers:         s.FollowersID(),
+		PublicKey: PublicKey{
+			ID:           s.KeyID(),
+			Owner:        s.ActorID(),
+			PublicKeyPem: publicKey,
+		},
+	}, nil
+}
+
+// WebFinger descriptor of the actor
+func (s *Service) WebFinger() *WebFinger {
+	return &WebFinger{
+		Subject: s.Account(),
+		Links: []WebFingerLink{{
+			Rel:  "self",
+			Type: ContentType,
+			Href: s.ActorID(),
+		}},
+	}
+}
+
+// Note of a message
+func (s *Service) Note(message *models.Message) *Note {
+	return &Note{
+		ID:           s.NoteID(message),
+		Type:         "Note",
+		AttributedTo: s.ActorID(),
+		Content:      "<p>" + html.EscapeString(message.Text) + "</p>",
+		Published:    message.CreatedAt,
+		To:           []string{Public},
+		Cc:           []string{s.FollowersID()},
+	}
+}
+
+// Create activity of a message
+func (s *Service) Create(message *models.Message) *Activity {
+	return &Activity{
+		Context:   Context,
+		ID:        s.NoteID(message) + "/activity",
+		Type:      "Create",
+		Actor:     s.ActorID(),
+		Object:    s.Note(message),
+		Published: &message.CreatedAt,
+		To:        []string{Public},
+		Cc:        []string{s.FollowersID()},
+	}
+}
+
+// Accept activity answering a follow request
+func (s *Service) Accept(follow *IncomingActivity) *Activity {
+	return &Activity{
+		Context: Context,
+		ID:      fmt.Sprintf("%s/ap/accepts/%s", s.BaseURL, uuid.New().String()),
+		Type:    "Accept",
+		Actor:   s.ActorID(),
+		Object:  follow,
+	}
+}
+
+// ======================================
+// Federation
+// ======================================
+
+// checkURL only allows https urls
+func (s *Service) checkURL(u *url.URL) error {
+	if u.Scheme == "https" || (s.AllowPrivate && u.Scheme == "http") {
+		return nil
+	}
+
+	return errors.Errorf("scheme %q not allowed", u.Scheme)
+}
+
+// checkAddress refuses connections to loopback, private and link-local addresses
+func (s *Service) checkAddress(network, address string, _ syscall.RawConn) error {
+	if s.AllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return errors.Errorf("address %s not allowed", host)
+	}
+
+	return nil
+}
+
+// newRequest creates a request to a remote url which passes checkURL
+func (s *Service) newRequest(ctx context.Context, method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// FetchActor loads a remote actor document with a signed request
+func (s *Service) FetchActor(ctx context.Context, id string) (*Actor, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, id, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad actor id")
+	}
+	req.Header.Set("Accept", ContentType)
+
+	if err := SignRequest(req, s.KeyID(), s.key, nil); err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch actor")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetch actor: unexpected status %d", res.StatusCode)
+	}
+
+	var actor Actor
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxDocumentSize)).Decode(&actor); err != nil {
+		return nil, errors.Wrap(err, "decode actor")
+	}
+
+	if actor.ID == "" || actor.Inbox == "" {
+		return nil, errors.New("actor without id or inbox")
+	}
+
+	// otherwise any server could claim to be someone else
+	if actor.ID != id {
+		return nil, errors.Errorf("actor %s has the id %s", id, actor.ID)
+	}
+
+	return &actor, nil
+}
+
+// FetchKey resolves a keyId to the public key of its owner
+func (s *Service) FetchKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	actorID := strings.SplitN(keyID, "#", 2)[0]
+
+	actor, err := s.FetchActor(ctx, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.PublicKey.ID != keyID {
+		return nil, errors.Errorf("actor %s has no key %s", actorID, keyID)
+	}
+
+	return DecodePublicKey(actor.PublicKey.PublicKeyPem)
+}
+
+// Verify the signature of an inbox request and return the signing actor
+func (s *Service) Verify(r *http.Request, body []byte) (string, error) {
+	keyID, err := VerifyRequest(r, body, func(keyID string) (*rsa.PublicKey, error) {
+		return s.FetchKey(r.Context(), keyID)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.SplitN(keyID, "#", 2)[0], nil
+}
+
+// Deliver posts a signed activity to an inbox
+func (s *Service) Deliver(ctx context.Context, inbox string, activity interface{}) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return errors.Wrap(err, "encode activity")
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "bad inbox")
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	if err := SignRequest(req, s.KeyID(), s.key, body); err != nil {
+		return err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "deliver activity")
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxDocumentSize))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("deliver activity to %s: unexpected status %d", inbox, res.StatusCode)
+	}
+
+	return nil
+}
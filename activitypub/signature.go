@@ -0,0 +1,195 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxClockSkew between the date header of a signed request and now
+const maxClockSkew = 12 * time.Hour
+
+// KeyFetcher resolves a keyId of a signature to a public key
+type KeyFetcher func(keyID string) (*rsa.PublicKey, error)
+
+// Digest calculates the digest header value of a body
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SignRequest signs a request with a http signature (draft-cavage), the
+// body is needed to calculate the digest and can be nil for GET requests
+func SignRequest(r *http.Request, keyID string, key *rsa.PrivateKey, body []byte) error {
+	if r.Header.Get("Date") == "" {
+		r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		r.Header.Set("Digest", Digest(body))
+		headers = append(headers, "digest")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(r, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return errors.Wrap(err, "sign request")
+	}
+
+	r.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID,
+		strings.Join(headers, " "),
+		base64.StdEncoding.EncodeToString(signature),
+	))
+
+	return nil
+}
+
+// VerifyRequest checks the http signature of a request and returns the keyId
+// which was used to sign it
+func VerifyRequest(r *http.Request, body []byte, fetch KeyFetcher) (string, error) {
+	params := parseSignature(r.Header.Get("Signature"))
+
+	keyID := params["keyId"]
+	if keyID == "" || params["signature"] == "" {
+		return "", errors.New("missing signature")
+	}
+
+	if algorithm := params["algorithm"]; algorithm != "" && algorithm != "rsa-sha256" && algorithm != "hs2019" {
+		return "", errors.Errorf("unsupported signature algorithm %s", algorithm)
+	}
+
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+
+	signed := map[string]bool{}
+	for _, header := range headers {
+		signed[header] = true
+	}
+
+	if !signed["(request-target)"] || !signed["host"] || !signed["date"] {
+		return "", errors.New("signature must cover (request-target), host and date")
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return "", errors.Wrap(err, "bad date header")
+	}
+	if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return "", errors.New("date header out of range")
+	}
+
+	if body != nil {
+		if !signed["digest"] {
+			return "", errors.New("signature must cover the digest")
+		}
+		if r.Header.Get("Digest") != Digest(body) {
+			return "", errors.New("digest mismatch")
+		}
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", errors.Wrap(err, "bad signature encoding")
+	}
+
+	key, err := fetch(keyID)
+	if err != nil {
+		return "", errors.Wrap(err, "fetch key")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(r, headers)))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature); err != nil {
+		return "", errors.Wrap(err, "bad signature")
+	}
+
+	return keyID, nil
+}
+
+// signingString builds the string which will be signed out of the headers
+func signingString(r *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+
+	for _, header := range headers {
+		var value string
+		switch header {
+		case "(request-target)":
+			value = fmt.Sprintf("%s %s", strings.ToLower(r.Method), r.URL.RequestURI())
+		case "host":
+			value = r.Host
+		default:
+			value = strings.Join(r.Header[http.CanonicalHeaderKey(header)], ", ")
+		}
+
+		lines = append(lines, fmt.Sprintf("%s: %s", header, value))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// parseSignature splits the signature header into its parameters
+func parseSignature(header string) map[string]string {
+	params := map[string]string{}
+
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+
+	return params
+}
+
+// EncodePublicKey as pem
+func EncodePublicKey(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// DecodePublicKey from pem
+func DecodePublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no pem data found")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not a rsa public key")
+	}
+
+	return rsaKey, nil
+}
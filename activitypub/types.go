@@ -0,0 +1,123 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// ContentType of activity streams documents
+	ContentType = "application/activity+json"
+
+	// Public is the special collection addressing everyone
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// Context is the json-ld context of all documents served by moc
+var Context = []string{
+	"https://www.w3.org/ns/activitystreams",
+	"https://w3id.org/security/v1",
+}
+
+// PublicKey of an actor
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Actor document
+type Actor struct {
+	Context           interface{} `json:"@context,omitempty"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername,omitempty"`
+	Name              string      `json:"name,omitempty"`
+	Summary           string      `json:"summary,omitempty"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox,omitempty"`
+	Followers         string      `json:"followers,omitempty"`
+	PublicKey         PublicKey   `json:"publicKey"`
+}
+
+// Note is the object representation of a message
+type Note struct {
+	Context      interface{} `json:"@context,omitempty"`
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	AttributedTo string      `json:"attributedTo"`
+	Content      string      `json:"content"`
+	Published    time.Time   `json:"published"`
+	To           []string    `json:"to"`
+	Cc           []string    `json:"cc,omitempty"`
+}
+
+// Activity wraps an object with a verb like Create, Follow or Accept
+type Activity struct {
+	Context   interface{} `json:"@context,omitempty"`
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Actor     string      `json:"actor"`
+	Object    interface{} `json:"object"`
+	Published *time.Time  `json:"published,omitempty"`
+	To        []string    `json:"to,omitempty"`
+	Cc        []string    `json:"cc,omitempty"`
+}
+
+// IncomingActivity is an activity posted to the inbox, the object stays raw
+// because it may be an id or an embedded document
+type IncomingActivity struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Actor  string          `json:"actor"`
+	Object json.RawMessage `json:"object"`
+}
+
+// ObjectID returns the id of the object, regardless if it is embedded or not
+func (a *IncomingActivity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(a.Object, &object); err == nil {
+		return object.ID
+	}
+
+	return ""
+}
+
+// EmbeddedActivity returns the object as activity if it is embedded
+func (a *IncomingActivity) EmbeddedActivity() *IncomingActivity {
+	var activity IncomingActivity
+	if err := json.Unmarshal(a.Object, &activity); err != nil {
+		return nil
+	}
+
+	return &activity
+}
+
+// OrderedCollection like outbox or followers
+type OrderedCollection struct {
+	Context      interface{}   `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	OrderedItems []interface{} `json:"orderedItems"`
+}
+
+// WebFinger resource descriptor
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+// WebFingerLink of a resource descriptor
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+
+	session "github.com/chaostreff-flensburg/moc/context"
+)
+
+// probes are polled all the time, they are only logged on debug level
+var probes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// redactedHeaders carry credentials and are never logged
+var redactedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+}
+
+// redactedParams carry credentials and are never logged
+var redactedParams = []string{"token"}
+
+// responseRecorder records the status and size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush keeps streams working
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// accessLog logs every request once the handler is done
+func (api *API) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = routePath(rctx.RoutePattern())
+		}
+
+		fields := logrus.Fields{
+			"method":     r.Method,
+			"route":      route,
+			"uri":        redactedURI(r),
+			"status":     recorder.status,
+			"bytes":      recorder.bytes,
+			"latency_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+			"remote_ip":  remoteIP(r),
+			"user_agent": r.UserAgent(),
+		}
+		if reqID := session.GetRequestID(r.Context()); reqID != nil {
+			fields["req_id"] = *reqID
+		}
+		if token, err := extractBearerToken(r); err == nil && token != "" {
+			fields["token"] = fingerprint(token)
+			fields["operator"] = token == api.config.OperatorToken
+		}
+
+		entry := api.accessLogger.WithFields(fields)
+		if entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+			entry = entry.WithField("headers", redactedHeaderValues(r.Header))
+		}
+
+		switch {
+		case probes[route]:
+			entry.Debug("request")
+		case recorder.status >= http.StatusInternalServerError:
+			entry.Error("request")
+		case recorder.status >= http.StatusBadRequest:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	})
+}
+
+// redactedURI of a request without credentials in the query
+func redactedURI(r *http.Request) string {
+	u := *r.URL
+	query := u.Query()
+
+	redacted := false
+	for _, name := range redactedParams {
+		if query.Get(name) != "" {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if redacted {
+		u.RawQuery = query.Encode()
+	}
+
+	return u.RequestURI()
+}
+
+// redactedHeaderValues of a request without credentials
+func redactedHeaderValues(header http.Header) map[string]string {
+	values := map[string]string{}
+	for name := range header {
+		if redactedHeaders[name] {
+			values[name] = "REDACTED"
+		} else {
+			values[name] = header.Get(name)
+		}
+	}
+
+	return values
+}
+
+// remoteIP of the client, requests over unix sockets have none
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// fingerprint tells tokens apart without logging them
+func fingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:4])
+}
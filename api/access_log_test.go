@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+func TestAccessLog(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	file, err := ioutil.TempFile("", "moc-access")
+	require.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	config := *apiTest.Config
+	config.OperatorToken = "secret"
+	config.Log.Level = "debug"
+	config.Log.Format = "json"
+	config.Log.Access = true
+	config.Log.AccessFile = file.Name()
+
+	api := NewAPI(apiTest.DB, &config)
+
+	message := models.NewMessage("Hackspace is open")
+	require.NoError(t, apiTest.DB.Create(message).Error)
+
+	requests := []*http.Request{
+		httptest.NewRequest("GET", "/messages/"+message.ID, nil),
+		httptest.NewRequest("GET", "/subscribers/confirm?token=subscriber-secret", nil),
+		httptest.NewRequest("GET", "/healthz", nil),
+	}
+	requests[0].Header.Set("Authorization", "Bearer secret")
+	requests[0].Header.Set("X-Request-ID", "request-1")
+
+	for _, r := range requests {
+		api.handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+
+	entries := []map[string]interface{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+
+	get := entries[0]
+	assert.Equal(t, "info", get["level"])
+	assert.Equal(t, "GET", get["method"])
+	assert.Equal(t, "/messages/{messageID}", get["route"])
+	assert.Equal(t, float64(http.StatusOK), get["status"])
+	assert.True(t, get["bytes"].(float64) > 0)
+	assert.Contains(t, get, "latency_ms")
+	assert.Equal(t, "192.0.2.1", get["remote_ip"])
+	assert.Equal(t, "request-1", get["req_id"])
+	assert.Equal(t, fingerprint("secret"), get["token"])
+	assert.Equal(t, true, get["operator"])
+	assert.Equal(t, "REDACTED", get["headers"].(map[string]interface{})["Authorization"])
+
+	confirm := entries[1]
+	assert.Equal(t, "warning", confirm["level"])
+	assert.Equal(t, float64(http.StatusNotFound), confirm["status"])
+	assert.Equal(t, "/subscribers/confirm?token=REDACTED", confirm["uri"])
+
+	healthz := entries[2]
+	assert.Equal(t, "debug", healthz["level"])
+}
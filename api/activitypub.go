@@ -0,0 +1,186 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/chaostreff-flensburg/moc/activitypub"
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// maxInboxSize of activities posted to the inbox
+const maxInboxSize = 1 << 20
+
+// outboxSize is the number of latest messages listed in the outbox
+const outboxSize = 20
+
+// webfinger resolves the moc account to its actor
+func (api *API) webfinger(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Query().Get("resource") != api.activityPub.Account() {
+		return router.NotFoundError("resource not found")
+	}
+
+	return router.SendJSONWithContentType(w, http.StatusOK, "application/jrd+json", api.activityPub.WebFinger())
+}
+
+// getActor delivers the actor document
+func (api *API) getActor(w http.ResponseWriter, r *http.Request) error {
+	actor, err := api.activityPub.Actor()
+	if err != nil {
+		return router.InternalServerError("actor not available").WithCode(router.CodeActivityPubActorUnavailable).WithInternalError(err)
+	}
+
+	return router.SendJSONWithContentType(w, http.StatusOK, activitypub.ContentType, actor)
+}
+
+// getOutbox delivers the latest messages as create activities
+func (api *API) getOutbox(w http.ResponseWriter, r *http.Request) error {
+	var count int
+	if res := api.database(r.Context()).Model(&models.Message{}).Count(&count); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	var messages []*models.Message
+	if res := api.database(r.Context()).Order("created_at desc").Limit(outboxSize).Find(&messages); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	items := make([]interface{}, 0, len(messages))
+	for _, message := range messages {
+		create := api.activityPub.Create(message)
+		create.Context = nil
+		items = append(items, create)
+	}
+
+	return router.SendJSONWithContentType(w, http.StatusOK, activitypub.ContentType, &activitypub.OrderedCollection{
+		Context:      activitypub.Context,
+		ID:           api.activityPub.BaseURL + "/ap/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   count,
+		OrderedItems: items,
+	})
+}
+
+// getFollowers delivers the number of followers, the list itself stays private
+func (api *API) getFollowers(w http.ResponseWriter, r *http.Request) error {
+	var count int
+	if res := api.database(r.Context()).Model(&models.Follower{}).Count(&count); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSONWithContentType(w, http.StatusOK, activitypub.ContentType, &activitypub.OrderedCollection{
+		Context:      activitypub.Context,
+		ID:           api.activityPub.FollowersID(),
+		Type:         "OrderedCollection",
+		TotalItems:   count,
+		OrderedItems: []interface{}{},
+	})
+}
+
+// getNote delivers a message as note
+func (api *API) getNote(w http.ResponseWriter, r *http.Request) error {
+	message := session.GetMessage(r.Context())
+
+	note := api.activityPub.Note(message)
+	note.Context = activitypub.Context
+
+	return router.SendJSONWithContentType(w, http.StatusOK, activitypub.ContentType, note)
+}
+
+// postInbox handles signed activities of remote actors
+func (api *API) postInbox(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	log := session.GetLogger(ctx)
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxInboxSize))
+	if err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	signer, err := api.activityPub.Verify(r, body)
+	if err != nil {
+		return router.UnauthorizedError("bad signature").WithCode(router.CodeActivityPubBadSignature).WithInternalError(err)
+	}
+
+	activity := &activitypub.IncomingActivity{}
+	if err := json.Unmarshal(body, activity); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	if activity.Actor != signer {
+		return router.UnauthorizedError("actor does not match signature").WithCode(router.CodeActivityPubActorMismatch)
+	}
+
+	log = log.WithField("actor", activity.Actor)
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != api.activityPub.ActorID() {
+			return router.BadRequestError("unknown follow object").WithCode(router.CodeActivityPubUnknownObject)
+		}
+
+		actor, err := api.activityPub.FetchActor(ctx, activity.Actor)
+		if err != nil {
+			return router.BadRequestError("actor not available").WithCode(router.CodeActivityPubActorUnavailable).WithInternalError(err)
+		}
+
+		follower := models.Follower{}
+		if res := api.database(ctx).Where(models.Follower{Actor: activity.Actor}).Assign(models.Follower{Inbox: actor.Inbox}).FirstOrCreate(&follower); res.Error != nil {
+			return router.HandleSQLError(res.Error)
+		}
+
+		log.Info("new follower")
+
+		accept := api.activityPub.Accept(activity)
+		api.background(func(ctx context.Context) {
+			if err := api.activityPub.Deliver(ctx, follower.Inbox, accept); err != nil {
+				log.WithError(err).Error("deliver accept failed")
+			}
+		})
+	case "Undo":
+		undo := activity.EmbeddedActivity()
+		if undo == nil || undo.Type != "Follow" {
+			break
+		}
+
+		if res := api.database(ctx).Where(models.Follower{Actor: activity.Actor}).Delete(models.Follower{}); res.Error != nil {
+			return router.HandleSQLError(res.Error)
+		}
+
+		log.Info("follower removed")
+	default:
+		log.WithField("type", activity.Type).Debug("ignore activity")
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	return nil
+}
+
+// federate delivers a new message to the inbox of every follower
+func (api *API) federate(ctx context.Context, message *models.Message) {
+	if api.activityPub == nil {
+		return
+	}
+
+	var followers []*models.Follower
+	if res := api.database(ctx).Find(&followers); res.Error != nil {
+		api.log.WithError(res.Error).Error("load followers failed")
+		return
+	}
+
+	create := api.activityPub.Create(message)
+	for _, follower := range followers {
+		follower := follower
+		api.background(func(ctx context.Context) {
+			if err := api.activityPub.Deliver(ctx, follower.Inbox, create); err != nil {
+				api.log.WithError(err).WithField("actor", follower.Actor).Error("deliver message failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/activitypub"
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// remoteActor is a stand-in for a fediverse server with a single actor
+type remoteActor struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	received chan *activitypub.IncomingActivity
+	t        *testing.T
+
+	// claim is served as actor id instead of the real one
+	claim string
+}
+
+func newRemoteActor(t *testing.T, apiTest *APITest) *remoteActor {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	remote := &remoteActor{
+		key:      key,
+		received: make(chan *activitypub.IncomingActivity, 10),
+		t:        t,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/actor", func(w http.ResponseWriter, r *http.Request) {
+		publicKey, _ := activitypub.EncodePublicKey(&key.PublicKey)
+
+		id := remote.ID()
+		if remote.claim != "" {
+			id = remote.claim
+		}
+
+		json.NewEncoder(w).Encode(activitypub.Actor{
+			ID:    id,
+			Type:  "Person",
+			Inbox: remote.server.URL + "/inbox",
+			PublicKey: activitypub.PublicKey{
+				ID:           remote.ID() + "#main-key",
+				Owner:        remote.ID(),
+				PublicKeyPem: publicKey,
+			},
+		})
+	})
+	mux.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		// check the signature with the key of moc
+		_, err := activitypub.VerifyRequest(r, body, func(keyID string) (*rsa.PublicKey, error) {
+			req := httptest.NewRequest("GET", "/ap/actor", nil)
+			w := httptest.NewRecorder()
+			NewAPI(apiTest.DB, apiTest.Config).handler.ServeHTTP(w, req)
+
+			var actor activitypub.Actor
+			json.NewDecoder(w.Body).Decode(&actor)
+
+			return activitypub.DecodePublicKey(actor.PublicKey.PublicKeyPem)
+		})
+		if err != nil {
+			t.Errorf("bad signature on delivery: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var activity activitypub.IncomingActivity
+		json.Unmarshal(body, &activity)
+		remote.received <- &activity
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	remote.server = httptest.NewServer(mux)
+
+	return remote
+}
+
+// ID of the remote actor
+func (remote *remoteActor) ID() string {
+	return remote.server.URL + "/actor"
+}
+
+// Post sends a signed activity to the moc inbox
+func (remote *remoteActor) Post(apiTest *APITest, activity interface{}, sign bool) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(activity)
+
+	r := httptest.NewRequest("POST", fmt.Sprintf("%s/ap/inbox", apiTest.BaseURL), bytes.NewReader(body))
+	if sign {
+		require.NoError(remote.t, activitypub.SignRequest(r, remote.ID()+"#main-key", remote.key, body))
+	}
+
+	w := httptest.NewRecorder()
+	NewAPI(apiTest.DB, apiTest.Config).handler.ServeHTTP(w, r)
+
+	return w
+}
+
+// Receive waits for the next delivered activity
+func (remote *remoteActor) Receive() *activitypub.IncomingActivity {
+	select {
+	case activity := <-remote.received:
+		return activity
+	case <-time.After(5 * time.Second):
+		remote.t.Fatal("no activity delivered")
+		return nil
+	}
+}
+
+func newActivityPubTest(t *testing.T) *APITest {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	dir, err := ioutil.TempDir("", "moc-activitypub")
+	require.NoError(t, err)
+
+	apiTest.Config.ActivityPub.Enabled = true
+	apiTest.Config.ActivityPub.BaseURL = "http://localhost"
+	apiTest.Config.ActivityPub.Username = "moc"
+	apiTest.Config.ActivityPub.KeyPath = filepath.Join(dir, "actor.pem")
+	apiTest.Config.ActivityPub.AllowPrivate = true
+
+	return apiTest
+}
+
+func TestActivityPubWebFinger(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+
+	r := apiTest.Request("GET", "/.well-known/webfinger?resource=acct:moc@localhost", nil)
+	assert.Equal(t, http.StatusOK, r.Code)
+
+	var finger activitypub.WebFinger
+	json.NewDecoder(r.Body).Decode(&finger)
+	assert.Equal(t, "http://localhost/ap/actor", finger.Links[0].Href)
+
+	r = apiTest.Request("GET", "/.well-known/webfinger?resource=acct:someone@localhost", nil)
+	assert.Equal(t, http.StatusNotFound, r.Code)
+
+	r = apiTest.Request("GET", "/ap/actor", nil)
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, activitypub.ContentType, r.Header().Get("Content-Type"))
+}
+
+func TestActivityPubFollowAndDeliver(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+
+	remote := newRemoteActor(t, apiTest)
+	defer remote.server.Close()
+
+	follow := map[string]interface{}{
+		"id":     remote.server.URL + "/follows/1",
+		"type":   "Follow",
+		"actor":  remote.ID(),
+		"object": "http://localhost/ap/actor",
+	}
+
+	// unsigned requests are rejected
+	r := remote.Post(apiTest, follow, false)
+	assert.Equal(t, http.StatusUnauthorized, r.Code)
+
+	r = remote.Post(apiTest, follow, true)
+	require.Equal(t, http.StatusAccepted, r.Code)
+
+	accept := remote.Receive()
+	assert.Equal(t, "Accept", accept.Type)
+	assert.Equal(t, remote.server.URL+"/follows/1", accept.EmbeddedActivity().ID)
+
+	var count int
+	apiTest.DB.Model(&models.Follower{}).Count(&count)
+	assert.Equal(t, 1, count)
+
+	// a new message is delivered to the follower
+	r = apiTest.Request("POST", "/messages", models.NewMessage("Testmessage").MessageRequest)
+	require.Equal(t, http.StatusOK, r.Code)
+
+	create := remote.Receive()
+	assert.Equal(t, "Create", create.Type)
+
+	var note activitypub.Note
+	json.Unmarshal(create.Object, &note)
+	assert.Equal(t, "<p>Testmessage</p>", note.Content)
+
+	// undo removes the follower
+	r = remote.Post(apiTest, map[string]interface{}{
+		"id":     remote.server.URL + "/follows/1/undo",
+		"type":   "Undo",
+		"actor":  remote.ID(),
+		"object": follow,
+	}, true)
+	assert.Equal(t, http.StatusAccepted, r.Code)
+
+	apiTest.DB.Model(&models.Follower{}).Count(&count)
+	assert.Equal(t, 0, count)
+}
+
+func TestActivityPubRejectPrivate(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+	apiTest.Config.ActivityPub.AllowPrivate = false
+
+	fetched := false
+	remote := newRemoteActor(t, apiTest)
+	defer remote.server.Close()
+	remote.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+	})
+
+	r := remote.Post(apiTest, map[string]interface{}{
+		"id":     remote.server.URL + "/follows/1",
+		"type":   "Follow",
+		"actor":  remote.ID(),
+		"object": "http://localhost/ap/actor",
+	}, true)
+	assert.Equal(t, http.StatusUnauthorized, r.Code)
+	assert.False(t, fetched)
+
+	// https does not help for loopback addresses
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+	}))
+	defer secure.Close()
+
+	service, err := activitypub.NewService(apiTest.Config)
+	require.NoError(t, err)
+
+	_, err = service.FetchActor(context.Background(), secure.URL+"/actor")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "address 127.0.0.1 not allowed")
+	assert.False(t, fetched)
+
+	var count int
+	apiTest.DB.Model(&models.Follower{}).Count(&count)
+	assert.Equal(t, 0, count)
+}
+
+func TestActivityPubActorMismatch(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+
+	remote := newRemoteActor(t, apiTest)
+	defer remote.server.Close()
+	remote.claim = "https://victim.example.com/actor"
+
+	r := remote.Post(apiTest, map[string]interface{}{
+		"id":     remote.server.URL + "/follows/1",
+		"type":   "Follow",
+		"actor":  remote.ID(),
+		"object": "http://localhost/ap/actor",
+	}, true)
+	assert.Equal(t, http.StatusUnauthorized, r.Code)
+
+	var count int
+	apiTest.DB.Model(&models.Follower{}).Count(&count)
+	assert.Equal(t, 0, count)
+}
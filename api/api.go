@@ -1,14 +1,19 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"sync"
 
 	"github.com/jinzhu/gorm"
-	"github.com/netlify/netlify-commons/graceful"
 	"github.com/rs/cors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/chaostreff-flensburg/moc/activitypub"
 	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/logging"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/relay"
 	"github.com/chaostreff-flensburg/moc/router"
 )
 
@@ -19,6 +24,18 @@ type API struct {
 	router  *router.Router
 	config  *config.Config
 	log     *logrus.Entry
+
+	accessLogger *logrus.Logger
+
+	activityPub *activitypub.Service
+	dispatcher  *relay.Dispatcher
+	openAPI     *openapi.Document
+	stream      *stream
+
+	server     *http.Server
+	jobs       sync.WaitGroup
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
 }
 
 // NewAPI creates a new API object according to the configuration
@@ -31,29 +48,130 @@ func NewAPI(db *gorm.DB, config *config.Config) *API {
 		router: r,
 		config: config,
 		log:    log,
+		stream: newStream(),
+	}
+	api.jobsCtx, api.cancelJobs = context.WithCancel(context.Background())
+
+	if config.ActivityPub.Enabled {
+		activityPub, err := activitypub.NewService(config)
+		if err != nil {
+			log.WithError(err).Fatal("activitypub setup failed")
+		}
+		api.activityPub = activityPub
 	}
 
+	r.UseBypass(withTracing)
 	r.Use(withRequestID)
-	r.Use(router.Recoverer)
+
+	if config.Log.Access {
+		api.accessLogger = logrus.StandardLogger()
+		if config.Log.AccessFile != "" {
+			accessLogger, err := logging.New(config, config.Log.AccessFile)
+			if err != nil {
+				log.WithError(err).Fatal("access log setup failed")
+			}
+			api.accessLogger = accessLogger
+		}
+		r.UseBypass(api.accessLog)
+	}
+
 	r.Use(api.withLogger)
+	r.UseBypass(router.Recoverer)
 
 	r.Use(api.withToken)
 
 	log.Info("initialize Routes...")
 
 	r.Route("/messages", func(r *router.Router) {
-		r.Get("/", api.getMessages)
-		r.With(authRequired).Post("/", api.createMessage)
+		r.With(api.withValidation).Get("/", api.getMessages)
+		r.With(authRequired).With(api.withValidation).Post("/", api.createMessage)
+		r.With(authRequired).With(api.withValidation).Delete("/", api.deleteMessages)
+		r.With(authRequired).With(api.withValidation).Post("/batch", api.createMessages)
+		r.With(authRequired).With(api.withValidation).Get("/export", api.exportMessages)
+		r.With(authRequired).With(api.withValidation).Post("/import", api.importMessages)
+		r.With(authRequired).With(api.withValidation).With(api.withTemplateID).Post("/from-template/{templateID}", api.createMessageFromTemplate)
+		r.Get("/stream", api.streamMessages)
 
 		r.Route("/{messageID}", func(r *router.Router) {
 			r.Use(authRequired)
+			r.Use(api.withValidation)
 			r.Use(api.withMessageID)
 
 			r.Get("/", api.getMessage)
 			r.Delete("/", api.deleteMessage)
+			r.Get("/deliveries", api.getDeliveries)
+		})
+	})
+
+	r.Route("/templates", func(r *router.Router) {
+		r.Use(authRequired)
+		r.Use(api.withValidation)
+
+		r.Get("/", api.getTemplates)
+		r.Post("/", api.createTemplate)
+
+		r.Route("/{templateID}", func(r *router.Router) {
+			r.Use(api.withTemplateID)
+
+			r.Get("/", api.getTemplate)
+			r.Put("/", api.updateTemplate)
+			r.Delete("/", api.deleteTemplate)
+		})
+	})
+
+	r.Route("/schedules", func(r *router.Router) {
+		r.Use(authRequired)
+		r.Use(api.withValidation)
+
+		r.Get("/", api.getSchedules)
+		r.Post("/", api.createSchedule)
+
+		r.Route("/{scheduleID}", func(r *router.Router) {
+			r.Use(api.withScheduleID)
+
+			r.Get("/", api.getSchedule)
+			r.Put("/", api.updateSchedule)
+			r.Delete("/", api.deleteSchedule)
+			r.Post("/pause", api.pauseSchedule)
+			r.Post("/resume", api.resumeSchedule)
+			r.Get("/preview", api.previewSchedule)
 		})
 	})
 
+	r.Route("/subscribers", func(r *router.Router) {
+		r.With(authRequired).With(api.withValidation).Get("/", api.getSubscribers)
+		r.With(api.withValidation).Post("/", api.createSubscriber)
+		r.With(api.withValidation).Get("/confirm", api.confirmSubscriber)
+		r.With(api.withValidation).Get("/unsubscribe", api.confirmUnsubscribe)
+		r.With(api.withValidation).Post("/unsubscribe", api.unsubscribe)
+	})
+
+	r.With(authRequired).With(api.withValidation).Get("/relays", api.getRelays)
+	r.Get("/openapi.json", api.getOpenAPI)
+
+	// probes of the orchestrator, without auth
+	r.Get("/healthz", api.healthz)
+	r.Get("/readyz", api.readyz)
+	r.Get("/version", api.getVersion)
+
+	if api.activityPub != nil {
+		r.Get("/.well-known/webfinger", api.webfinger)
+
+		r.Route("/ap", func(r *router.Router) {
+			r.Get("/actor", api.getActor)
+			r.Get("/outbox", api.getOutbox)
+			r.Get("/followers", api.getFollowers)
+			r.With(api.withValidation).Post("/inbox", api.postInbox)
+			r.With(api.withValidation).With(api.withMessageID).Get("/notes/{messageID}", api.getNote)
+		})
+	}
+
+	openAPI, err := openAPI(r)
+	if err != nil {
+		log.WithError(err).Fatal("openapi setup failed")
+	}
+	api.openAPI = openAPI
+
 	corsHandler := cors.New(cors.Options{
 		AllowedMethods:   []string{"GET", "POST", "PATCH", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Request-ID"},
@@ -62,19 +180,18 @@ func NewAPI(db *gorm.DB, config *config.Config) *API {
 	})
 	api.handler = corsHandler.Handler(r)
 
+	api.server = &http.Server{Handler: api.handler}
+	api.server.RegisterOnShutdown(api.stream.close)
+
 	return api
 }
 
-// ListenAndServe will finally start the real http server
-func (api *API) ListenAndServe(addr string) {
-	api.log.Info("Start App...")
-
-	server := graceful.NewGracefulServer(api.handler, api.log)
-	if err := server.Bind(addr); err != nil {
-		api.log.WithError(err).Fatal("http server bind failed")
-	}
+// SetDispatcher hands message changes to the relays running in the server
+func (api *API) SetDispatcher(dispatcher *relay.Dispatcher) {
+	api.dispatcher = dispatcher
+}
 
-	if err := server.Listen(); err != nil {
-		api.log.WithError(err).Fatal("http server listen failed")
-	}
+// Handler serves the api, it is used to test against a real http server
+func (api *API) Handler() http.Handler {
+	return api.handler
 }
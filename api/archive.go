@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/archive"
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// exportMessages streams all messages with the deleted ones as json lines or
+// csv, optionally created in a time range
+func (api *API) exportMessages(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+
+	format, err := archiveFormat(r)
+	if err != nil {
+		return err
+	}
+
+	filter := archive.Filter{}
+	for _, param := range []struct {
+		name string
+		time *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		if value := query.Get(param.name); value != "" {
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return router.BadRequestError("bad %s", param.name).WithCode(router.CodeInvalidParameter).WithInternalError(err)
+			}
+			*param.time = t
+		}
+	}
+
+	w.Header().Set("Content-Type", archive.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="messages.`+format+`"`)
+
+	// the status is sent with the first message, errors can only end the stream
+	count, err := archive.Export(api.database(r.Context()), w, format, filter)
+	if err != nil {
+		session.GetLogger(r.Context()).WithError(err).Error("export failed")
+	}
+
+	auditFields(r, "messages.export", logrus.Fields{"count": count, "format": format})
+
+	return nil
+}
+
+// importMessages of an archive in one transaction, the conflict param tells
+// what happens to messages with an existing id
+func (api *API) importMessages(w http.ResponseWriter, r *http.Request) error {
+	format, err := archiveFormat(r)
+	if err != nil {
+		return err
+	}
+
+	mode := r.URL.Query().Get("conflict")
+	if mode == "" {
+		mode = archive.Fail
+	}
+	if !archive.ValidMode(mode) {
+		return router.BadRequestError("bad conflict").WithCode(router.CodeInvalidParameter).
+			WithJsonError(openapi.Errors{"conflict": "enum"})
+	}
+
+	result, err := archive.Import(api.database(r.Context()), r.Body, format, mode)
+	if conflict, ok := err.(*archive.ConflictError); ok {
+		return router.ConflictError("%s", conflict.Error()).WithCode(router.CodeArchiveConflict)
+	}
+	if err != nil {
+		return router.BadRequestError("bad archive, %v", err).WithCode(router.CodeArchiveInvalid).WithInternalError(err)
+	}
+
+	auditFields(r, "messages.import", logrus.Fields{
+		"format":      format,
+		"conflict":    mode,
+		"created":     result.Created,
+		"overwritten": result.Overwritten,
+		"skipped":     result.Skipped,
+	})
+
+	return router.SendJSON(w, http.StatusOK, result)
+}
+
+// archiveFormat of the format param, json lines by default
+func archiveFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return archive.JSONLines, nil
+	}
+
+	if !archive.ValidFormat(format) {
+		return "", router.BadRequestError("bad format").WithCode(router.CodeInvalidParameter).
+			WithJsonError(openapi.Errors{"format": "enum"})
+	}
+
+	return format, nil
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/archive"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestExportImportMessages(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	message := models.NewMessage("Hackspace is open")
+	require.NoError(t, apiTest.DB.Create(message).Error)
+	deleted := models.NewMessage("Hackspace is closed")
+	require.NoError(t, apiTest.DB.Create(deleted).Error)
+	require.NoError(t, apiTest.DB.Delete(deleted).Error)
+
+	w := httptest.NewRecorder()
+	api.handler.ServeHTTP(w, httptest.NewRequest("GET", "/messages/export?format=csv", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+	export := w.Body.String()
+	lines := strings.Split(strings.TrimSpace(export), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[1], message.ID+",Hackspace is open,"))
+	assert.True(t, strings.HasPrefix(lines[2], deleted.ID+",Hackspace is closed,"))
+	assert.False(t, strings.HasSuffix(lines[2], ",,,"), "deleted_at is exported")
+
+	importMessages := func(conflict string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, httptest.NewRequest("POST", "/messages/import?format=csv&conflict="+conflict, bytes.NewBufferString(export)))
+		return w
+	}
+
+	w = importMessages("")
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, router.CodeArchiveConflict, err.ErrorCode)
+	assert.Equal(t, "entry 1: message "+message.ID+" exists", err.Message)
+
+	w = importMessages("skip")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	result := &archive.Result{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(result))
+	assert.Equal(t, &archive.Result{Skipped: 2}, result)
+
+	assert.Equal(t, http.StatusBadRequest, importMessages("merge").Code)
+
+	w = httptest.NewRecorder()
+	api.handler.ServeHTTP(w, httptest.NewRequest("POST", "/messages/import", strings.NewReader("no json")))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, router.CodeArchiveInvalid, err.ErrorCode)
+}
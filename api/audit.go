@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// audit logs a change of many messages by an operator with the field
+// audit, so the entries can be kept apart from the request logs
+func audit(r *http.Request, action string, messages []*models.Message) {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	auditFields(r, action, logrus.Fields{"count": len(ids), "ids": ids})
+}
+
+// auditFields logs a change by an operator with the details in fields
+func auditFields(r *http.Request, action string, fields logrus.Fields) {
+	fields["audit"] = true
+	fields["action"] = action
+	fields["remote_ip"] = remoteIP(r)
+
+	if token, err := extractBearerToken(r); err == nil && token != "" {
+		fields["token"] = fingerprint(token)
+	}
+
+	session.GetLogger(r.Context()).WithFields(fields).Info("audit")
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+	"github.com/chaostreff-flensburg/moc/version"
+)
+
+// readyTimeout of the database ping
+const readyTimeout = 2 * time.Second
+
+// health of the server
+type health struct {
+	Status string `json:"status"`
+}
+
+// healthz tells the orchestrator the process is alive
+func (api *API) healthz(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, health{Status: "ok"})
+}
+
+// readyz tells the orchestrator the server can take requests, the database
+// is reachable and migrated
+func (api *API) readyz(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	if err := api.db.DB().PingContext(ctx); err != nil {
+		return router.UnavailableServiceError("database unreachable").WithCode(router.CodeDatabaseUnreachable).WithInternalError(err)
+	}
+
+	if pending := models.Pending(api.database(ctx)); len(pending) > 0 {
+		return router.UnavailableServiceError("migration pending").WithCode(router.CodeMigrationPending).WithJsonError(pending)
+	}
+
+	return router.SendJSON(w, http.StatusOK, health{Status: "ok"})
+}
+
+// getVersion delivers the version of the build
+func (api *API) getVersion(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, version.Get())
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+	"github.com/chaostreff-flensburg/moc/version"
+)
+
+func TestHealth(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	w := apiTest.Request("GET", "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = apiTest.Request("GET", "/readyz", nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = apiTest.Request("GET", "/version", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var info version.Info
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(t, "dev", info.Version)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+
+	// a missing table is a pending migration
+	apiTest.DB.DropTable(&models.Subscriber{})
+
+	w = apiTest.Request("GET", "/readyz", nil)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, []interface{}{"subscribers"}, err.Json)
+
+	// the process is still alive
+	w = apiTest.Request("GET", "/healthz", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a closed database is unreachable
+	apiTest.DB.Close()
+
+	w = apiTest.Request("GET", "/readyz", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -2,22 +2,84 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/chaostreff-flensburg/moc/config"
 	session "github.com/chaostreff-flensburg/moc/context"
 	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/relay"
 	"github.com/chaostreff-flensburg/moc/router"
 )
 
-// getMessages delivers all messages
+// getMessages delivers all messages, optionally created since a time and
+// split into pages
 func (api *API) getMessages(w http.ResponseWriter, r *http.Request) error {
-	var message []*models.Message
+	query := r.URL.Query()
+	db := api.database(r.Context()).Model(&models.Message{})
+
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			return router.BadRequestError("bad since").WithCode(router.CodeInvalidParameter).WithInternalError(err)
+		}
+		db = db.Where("created_at >= ?", t)
+	}
 
-	if res := api.db.Find(&message); res.Error != nil {
+	var total int
+	if res := db.Count(&total); res.Error != nil {
 		return router.HandleSQLError(res.Error)
 	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 
-	return router.SendJSON(w, http.StatusOK, message)
+	if perPage, _ := strconv.Atoi(query.Get("per_page")); perPage > 0 {
+		page, _ := strconv.Atoi(query.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+
+		setPaginationLink(w, r, page, perPage, total)
+		db = db.Offset((page - 1) * perPage).Limit(perPage)
+	}
+
+	messages := []*models.Message{}
+	if res := db.Order("created_at").Find(&messages); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, messages)
+}
+
+// setPaginationLink adds the next and last page to the link header
+func setPaginationLink(w http.ResponseWriter, r *http.Request, page int, perPage int, total int) {
+	last := (total + perPage - 1) / perPage
+	if last < 1 {
+		last = 1
+	}
+
+	link := func(page int, rel string) string {
+		u := *r.URL
+		query := u.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = query.Encode()
+
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+	}
+
+	links := []string{}
+	if page < last {
+		links = append(links, link(page+1, "next"))
+	}
+	links = append(links, link(last, "last"))
+
+	w.Header().Set("Link", strings.Join(links, ", "))
 }
 
 // createMessage
@@ -30,18 +92,151 @@ func (api *API) createMessage(w http.ResponseWriter, r *http.Request) error {
 	message := &models.Message{}
 
 	if err := json.NewDecoder(r.Body).Decode(&message.MessageRequest); err != nil {
-		return router.BadRequestError("bad payload").WithInternalError(err)
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	if res := api.database(ctx).Create(message); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	api.federate(ctx, message)
+	api.publish(relay.Event{Type: relay.EventCreated, Message: message})
+
+	return router.SendJSON(w, http.StatusOK, message)
+}
+
+// maxBatchSize of created messages per request
+const maxBatchSize = 100
+
+// createMessages of a batch in one transaction, either all items are valid
+// and created or none
+func (api *API) createMessages(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	batch := &models.MessageBatchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(batch); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	if len(batch.Messages) == 0 || len(batch.Messages) > maxBatchSize {
+		return router.BadRequestError("a batch has 1 to %d messages", maxBatchSize).WithCode(router.CodeInvalidPayload).
+			WithJsonError(openapi.Errors{"messages": "size"})
+	}
+
+	errors := openapi.Errors{}
+	for i := range batch.Messages {
+		if invalid := batch.Messages[i].Validate(); invalid != nil {
+			for field, rule := range *invalid {
+				errors[fmt.Sprintf("messages[%d].%s", i, field)] = rule
+			}
+		}
+	}
+	if len(errors) > 0 {
+		return api.badPayload(r, errors)
+	}
+
+	results := make([]*models.MessageBatchResult, 0, len(batch.Messages))
+
+	tx := api.database(ctx).Begin()
+	for i, request := range batch.Messages {
+		message := &models.Message{MessageRequest: request}
+		if res := tx.Create(message); res.Error != nil {
+			tx.Rollback()
+			return router.HandleSQLError(res.Error)
+		}
+		results = append(results, &models.MessageBatchResult{Index: i, Message: message})
+	}
+	if res := tx.Commit(); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	messages := make([]*models.Message, 0, len(results))
+	for _, result := range results {
+		api.federate(ctx, result.Message)
+		api.publish(relay.Event{Type: relay.EventCreated, Message: result.Message})
+		messages = append(messages, result.Message)
+	}
+	audit(r, "messages.create", messages)
+
+	return router.SendJSON(w, http.StatusOK, results)
+}
+
+// deleteMessages by ids or by the time they were created, a filter is needed
+// so a bare request can't delete all messages
+func (api *API) deleteMessages(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	db := api.database(ctx).Model(&models.Message{})
+	filtered := false
+
+	if ids := config.List(query.Get("ids")); len(ids) > 0 {
+		for _, id := range ids {
+			if _, err := uuid.Parse(id); err != nil {
+				return router.BadRequestError("bad ids").WithCode(router.CodeInvalidParameter).
+					WithJsonError(openapi.Errors{"ids": "uuid"}).WithInternalError(err)
+			}
+		}
+		db = db.Where("id IN (?)", ids)
+		filtered = true
+	}
+
+	for _, filter := range []struct {
+		param string
+		where string
+	}{
+		{"since", "created_at >= ?"},
+		{"before", "created_at < ?"},
+	} {
+		value := query.Get(filter.param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return router.BadRequestError("bad %s", filter.param).WithCode(router.CodeInvalidParameter).WithInternalError(err)
+		}
+		db = db.Where(filter.where, t)
+		filtered = true
 	}
 
-	if err := message.MessageRequest.Validate(); err != nil {
-		return router.BadRequestError("bad payload").WithJsonError(err)
+	if !filtered {
+		return router.BadRequestError("need ids, since or before").WithCode(router.CodeInvalidParameter).
+			WithJsonError(openapi.Errors{"ids": "required"})
 	}
 
-	if res := api.db.Create(message); res.Error != nil {
+	// the transaction keeps the filter
+	tx := db.Begin()
+
+	messages := []*models.Message{}
+	if res := tx.Order("created_at").Find(&messages); res.Error != nil {
+		tx.Rollback()
 		return router.HandleSQLError(res.Error)
 	}
 
-	return router.SendJSON(w, http.StatusOK, message)
+	if len(messages) > 0 {
+		ids := make([]string, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+
+		if res := tx.Where("id IN (?)", ids).Delete(&models.Message{}); res.Error != nil {
+			tx.Rollback()
+			return router.HandleSQLError(res.Error)
+		}
+	}
+
+	if res := tx.Commit(); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	for _, message := range messages {
+		api.publish(relay.Event{Type: relay.EventDeleted, Message: message})
+	}
+	audit(r, "messages.delete", messages)
+
+	return router.SendJSON(w, http.StatusOK, messages)
 }
 
 // delivers message
@@ -65,9 +260,23 @@ func (api *API) deleteMessage(w http.ResponseWriter, r *http.Request) error {
 
 	message := session.GetMessage(ctx)
 
-	if res := api.db.Delete(message); res.Error != nil {
+	if res := api.database(ctx).Delete(message); res.Error != nil {
 		return router.HandleSQLError(res.Error)
 	}
 
+	api.publish(relay.Event{Type: relay.EventDeleted, Message: message})
+
 	return router.SendJSON(w, http.StatusOK, message)
 }
+
+// delivers the relay status of a message
+func (api *API) getDeliveries(w http.ResponseWriter, r *http.Request) error {
+	message := session.GetMessage(r.Context())
+
+	var deliveries []*models.Delivery
+	if res := api.database(r.Context()).Where(models.Delivery{MessageID: message.ID}).Find(&deliveries); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, deliveries)
+}
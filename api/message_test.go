@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/chaostreff-flensburg/moc/models"
 	"github.com/chaostreff-flensburg/moc/router"
@@ -81,14 +83,14 @@ func TestCreateMessage(t *testing.T) {
 		url:     "/messages",
 		code:    http.StatusBadRequest,
 		data:    models.MessageRequest{},
-		exepted: *router.BadRequestError("bad payload").WithJsonError(map[string]interface{}{"message": "required"}),
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"message": "required"}).WithMessages(map[string]string{"message": "message is required"}),
 	}, {
 		name:    "with wrong data",
 		method:  "POST",
 		url:     "/messages",
 		code:    http.StatusBadRequest,
 		data:    models.NewMessage("ab").MessageRequest,
-		exepted: *router.BadRequestError("bad payload").WithJsonError(map[string]interface{}{"message": "min"}),
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"message": "min"}).WithMessages(map[string]string{"message": "message must be at least 3 characters long"}),
 	}}
 
 	options := []cmp.Option{
@@ -144,13 +146,13 @@ func TestGetMessage(t *testing.T) {
 		method:  "GET",
 		url:     fmt.Sprintf("/messages/%s", "teeest"),
 		code:    http.StatusBadRequest,
-		exepted: *router.BadRequestError("bad messageID"),
+		exepted: *router.BadRequestError("bad messageID").WithCode(router.CodeInvalidParameter).WithJsonError(map[string]interface{}{"messageID": "uuid"}).WithMessages(map[string]string{"messageID": "messageID must be a valid uuid"}),
 	}, {
 		name:    "with not existing id",
 		method:  "GET",
 		url:     fmt.Sprintf("/messages/%s", uuid.New().String()),
 		code:    http.StatusNotFound,
-		exepted: *router.NotFoundError("message not found"),
+		exepted: *router.NotFoundError("message not found").WithCode(router.CodeMessageNotFound),
 	}}
 
 	options := []cmp.Option{
@@ -206,13 +208,13 @@ func TestDeleteMessage(t *testing.T) {
 		method:  "DELETE",
 		url:     fmt.Sprintf("/messages/%s", "teeest"),
 		code:    http.StatusBadRequest,
-		exepted: *router.BadRequestError("bad messageID"),
+		exepted: *router.BadRequestError("bad messageID").WithCode(router.CodeInvalidParameter).WithJsonError(map[string]interface{}{"messageID": "uuid"}).WithMessages(map[string]string{"messageID": "messageID must be a valid uuid"}),
 	}, {
 		name:    "with not existing id",
 		method:  "DELETE",
 		url:     fmt.Sprintf("/messages/%s", uuid.New().String()),
 		code:    http.StatusNotFound,
-		exepted: *router.NotFoundError("message not found"),
+		exepted: *router.NotFoundError("message not found").WithCode(router.CodeMessageNotFound),
 	}}
 
 	options := []cmp.Option{
@@ -243,3 +245,136 @@ func TestDeleteMessage(t *testing.T) {
 		}
 	}
 }
+
+func TestGetMessagesPaginated(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	for i := 0; i < 5; i++ {
+		apiTest.DB.Create(models.NewMessage(fmt.Sprintf("Message %d", i)))
+		time.Sleep(time.Millisecond)
+	}
+
+	r := apiTest.Request("GET", "/messages?page=2&per_page=2", nil)
+	assert.Equal(t, http.StatusOK, r.Code)
+	assert.Equal(t, "5", r.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</messages?page=3&per_page=2>; rel="next", </messages?page=3&per_page=2>; rel="last"`, r.Header().Get("Link"))
+
+	var response []models.Message
+	json.NewDecoder(r.Body).Decode(&response)
+	require.Len(t, response, 2)
+	assert.Equal(t, "Message 2", response[0].Text)
+	assert.Equal(t, "Message 3", response[1].Text)
+
+	r = apiTest.Request("GET", "/messages?per_page=101", nil)
+	assert.Equal(t, http.StatusBadRequest, r.Code)
+
+	since := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	r = apiTest.Request("GET", "/messages?since="+since, nil)
+	assert.Equal(t, "0", r.Header().Get("X-Total-Count"))
+	assert.Equal(t, "[]", r.Body.String())
+}
+
+func TestCreateMessages(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	batch := models.MessageBatchRequest{Messages: []models.MessageRequest{
+		{Text: "Hackspace is open"},
+		{Text: "ab"},
+		{Text: ""},
+	}}
+
+	// one bad item fails the whole batch
+	w := apiTest.Request("POST", "/messages/batch", batch)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, map[string]interface{}{"messages[1].message": "min", "messages[2].message": "required"}, err.Json)
+
+	var count int
+	apiTest.DB.Model(&models.Message{}).Count(&count)
+	assert.Equal(t, 0, count)
+
+	batch.Messages[1].Text = "Talk at 8pm"
+	batch.Messages[2].Text = "Hackspace is closed"
+
+	w = apiTest.Request("POST", "/messages/batch", batch)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var results []models.MessageBatchResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+	require.Len(t, results, 3)
+	for i, result := range results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, batch.Messages[i].Text, result.Message.Text)
+		assert.NotEmpty(t, result.Message.ID)
+	}
+
+	apiTest.DB.Model(&models.Message{}).Count(&count)
+	assert.Equal(t, 3, count)
+
+	w = apiTest.Request("POST", "/messages/batch", models.MessageBatchRequest{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDeleteMessages(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	messages := []*models.Message{}
+	for i, text := range []string{"Hackspace is open", "Talk at 8pm", "Hackspace is closed", "Hackspace is open again"} {
+		message := models.NewMessage(text)
+		message.CreatedAt = time.Date(2019, 5, 1, i, 0, 0, 0, time.UTC)
+		require.NoError(t, apiTest.DB.Create(message).Error)
+		messages = append(messages, message)
+	}
+
+	testCases := []struct {
+		name    string
+		query   url.Values
+		code    int
+		deleted []*models.Message
+	}{{
+		name: "without filter",
+		code: http.StatusBadRequest,
+	}, {
+		name:  "bad id",
+		query: url.Values{"ids": {"1"}},
+		code:  http.StatusBadRequest,
+	}, {
+		name:    "by ids",
+		query:   url.Values{"ids": {messages[0].ID + "," + messages[2].ID}},
+		code:    http.StatusOK,
+		deleted: []*models.Message{messages[0], messages[2]},
+	}, {
+		name:    "by time",
+		query:   url.Values{"since": {"2019-05-01T01:00:00Z"}, "before": {"2019-05-01T03:00:00Z"}},
+		code:    http.StatusOK,
+		deleted: []*models.Message{messages[1]},
+	}}
+
+	for _, testCase := range testCases {
+		w := apiTest.Request("DELETE", "/messages?"+testCase.query.Encode(), nil)
+		require.Equal(t, testCase.code, w.Code, testCase.name)
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var deleted []*models.Message
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&deleted))
+
+		ids := []string{}
+		for _, message := range deleted {
+			ids = append(ids, message.ID)
+		}
+		expected := []string{}
+		for _, message := range testCase.deleted {
+			expected = append(expected, message.ID)
+		}
+		assert.Equal(t, expected, ids, testCase.name)
+	}
+
+	var left []*models.Message
+	require.NoError(t, apiTest.DB.Find(&left).Error)
+	require.Len(t, left, 1)
+	assert.Equal(t, messages[3].ID, left[0].ID)
+}
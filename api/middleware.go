@@ -1,33 +1,40 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
 	logrus "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 
 	session "github.com/chaostreff-flensburg/moc/context"
 	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
 	"github.com/chaostreff-flensburg/moc/router"
+	"github.com/chaostreff-flensburg/moc/validator"
 )
 
+// maxBodySize of validated request bodies
+const maxBodySize = 1 << 20
+
 // withMessageID load message entity by request param
 func (api *API) withMessageID(w http.ResponseWriter, r *http.Request) (context.Context, error) {
 	messageID := chi.URLParam(r, "messageID")
 
-	if _, err := uuid.Parse(messageID); err != nil {
-		return nil, router.BadRequestError("bad messageID").WithInternalError(err)
-	}
-
 	var message models.Message
-	if res := api.db.First(&message, models.Message{ID: messageID}); res.Error != nil {
+	if res := api.database(r.Context()).First(&message, models.Message{ID: messageID}); res.Error != nil {
 		if gorm.IsRecordNotFoundError(res.Error) {
-			return nil, router.NotFoundError("message not found")
+			return nil, router.NotFoundError("message not found").WithCode(router.CodeMessageNotFound)
 		}
 
 		return nil, router.HandleSQLError(res.Error)
@@ -39,6 +46,145 @@ func (api *API) withMessageID(w http.ResponseWriter, r *http.Request) (context.C
 	return ctx, nil
 }
 
+// withValidation checks the params and the json body of a request against
+// the openapi document, so handlers get valid requests only. It runs per
+// route after authRequired, unauthenticated clients get a 401 instead of
+// the rules of the schema.
+func (api *API) withValidation(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	pattern, params, ok := api.router.Match(r.Method, r.URL.Path)
+	if !ok || api.openAPI == nil {
+		return nil, nil
+	}
+
+	operation := api.openAPI.Operation(r.Method, routePath(pattern))
+	if operation == nil {
+		return nil, nil
+	}
+
+	query := map[string]string{}
+	for name, values := range r.URL.Query() {
+		query[name] = values[0]
+	}
+
+	errors := openapi.Errors{}
+	for name, rule := range api.openAPI.ValidateParameters(operation, "path", params) {
+		errors[name] = rule
+	}
+	for name, rule := range api.openAPI.ValidateParameters(operation, "query", query) {
+		errors[name] = rule
+	}
+
+	if len(errors) > 0 {
+		names := make([]string, 0, len(errors))
+		for name := range errors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, router.BadRequestError("bad %s", strings.Join(names, ", ")).WithCode(router.CodeInvalidParameter).WithJsonError(errors).
+			WithMessages(api.describe(r, operation, errors))
+	}
+
+	if operation.RequestBody == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if _, ok := err.(*http.MaxBytesError); ok {
+		return nil, router.RequestEntityTooLargeError("payload too large").WithCode(router.CodeTooLarge)
+	}
+	if err != nil {
+		return nil, router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	for _, media := range operation.RequestBody.Content {
+		for path, rule := range api.openAPI.ValidateJSON(media.Schema, body) {
+			errors[path] = rule
+		}
+	}
+
+	if len(errors) > 0 {
+		return nil, router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(errors).
+			WithMessages(api.describe(r, operation, errors))
+	}
+
+	return nil, nil
+}
+
+// badPayload answers the violations of a body found by a handler
+func (api *API) badPayload(r *http.Request, errors openapi.Errors) *router.HTTPError {
+	err := router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(errors)
+
+	if pattern, _, ok := api.router.Match(r.Method, r.URL.Path); ok && api.openAPI != nil {
+		if operation := api.openAPI.Operation(r.Method, routePath(pattern)); operation != nil {
+			err.WithMessages(api.describe(r, operation, errors))
+		}
+	}
+
+	return err
+}
+
+// describe the violated rules in the language of the Accept-Language header
+func (api *API) describe(r *http.Request, operation *openapi.Operation, errors openapi.Errors) map[string]string {
+	trans := validator.Translator(r.Header.Get("Accept-Language"))
+
+	messages := map[string]string{}
+	for path, rule := range errors {
+		schema := api.schemaOf(operation, path)
+
+		limit := ""
+		number := schema != nil && (schema.Type == "integer" || schema.Type == "number")
+		switch {
+		case rule == "min" && number && schema.Minimum != nil:
+			limit = strconv.FormatFloat(*schema.Minimum, 'f', -1, 64)
+		case rule == "max" && number && schema.Maximum != nil:
+			limit = strconv.FormatFloat(*schema.Maximum, 'f', -1, 64)
+		case rule == "min" && schema != nil && schema.MinLength != nil:
+			limit = strconv.Itoa(*schema.MinLength)
+		case rule == "max" && schema != nil && schema.MaxLength != nil:
+			limit = strconv.Itoa(*schema.MaxLength)
+		}
+
+		if number && (rule == "min" || rule == "max") {
+			rule += "_number"
+		}
+
+		messages[path] = validator.Message(trans, path, rule, limit)
+	}
+
+	return messages
+}
+
+// schemaOf the parameter or body value at a path of the validation errors
+func (api *API) schemaOf(operation *openapi.Operation, path string) *openapi.Schema {
+	for _, parameter := range operation.Parameters {
+		if parameter.Name == path {
+			return api.openAPI.Resolve(parameter.Schema)
+		}
+	}
+
+	if operation.RequestBody != nil {
+		for _, media := range operation.RequestBody.Content {
+			if schema := api.openAPI.Property(media.Schema, path); schema != nil {
+				return schema
+			}
+		}
+	}
+
+	// values built by a handler, like the rendered text of a template, are
+	// checked against the response
+	if response, ok := operation.Responses[strconv.Itoa(http.StatusOK)]; ok {
+		for _, media := range response.Content {
+			if schema := api.openAPI.Property(media.Schema, path); schema != nil {
+				return schema
+			}
+		}
+	}
+
+	return nil
+}
+
 // withLogger add request details to log output
 func (api *API) withLogger(w http.ResponseWriter, r *http.Request) (context.Context, error) {
 	ctx := r.Context()
@@ -49,12 +195,15 @@ func (api *API) withLogger(w http.ResponseWriter, r *http.Request) (context.Cont
 	if reqID := session.GetRequestID(ctx); reqID != nil {
 		logFields["req_id"] = *reqID
 	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logFields["trace_id"] = spanContext.TraceID().String()
+	}
 
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
 	}
-	logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
+	logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, r.Host, redactedURI(r))
 
 	requestLogger := api.log.WithFields(logFields)
 
@@ -0,0 +1,466 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaostreff-flensburg/moc/activitypub"
+	"github.com/chaostreff-flensburg/moc/archive"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/router"
+	"github.com/chaostreff-flensburg/moc/version"
+)
+
+// operation documents a route for the openapi document
+type operation struct {
+	summary     string
+	tag         string
+	auth        bool
+	query       []*openapi.Parameter
+	request     interface{}
+	status      int
+	response    interface{}
+	contentType string
+}
+
+// operations of all routes by method and path, a route without operation
+// fails the api setup
+var operations = map[string]operation{
+	"GET /messages": {
+		summary: "Get all messages",
+		tag:     "Messages",
+		query: []*openapi.Parameter{
+			{Name: "since", Description: "only messages created since", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "page", Description: "page starting at 1", Schema: &openapi.Schema{Type: "integer", Minimum: number(1)}},
+			{Name: "per_page", Description: "messages per page, all if not set", Schema: &openapi.Schema{Type: "integer", Minimum: number(1), Maximum: number(maxPerPage)}},
+		},
+		response: []*models.Message{},
+	},
+	"GET /messages/stream": {
+		summary:     "Stream created and deleted messages as server-sent events",
+		tag:         "Messages",
+		response:    models.Message{},
+		contentType: "text/event-stream",
+	},
+	"POST /messages": {
+		summary:  "Create a new message",
+		tag:      "Messages",
+		auth:     true,
+		request:  models.MessageRequest{},
+		response: models.Message{},
+	},
+	"DELETE /messages": {
+		summary: "Delete the messages of a list of ids or created in a time range",
+		tag:     "Messages",
+		auth:    true,
+		query: []*openapi.Parameter{
+			{Name: "ids", Description: "comma separated ids", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "since", Description: "only messages created since", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "before", Description: "only messages created before", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		},
+		response: []*models.Message{},
+	},
+	"POST /messages/batch": {
+		summary:  "Create up to 100 messages in one transaction",
+		tag:      "Messages",
+		auth:     true,
+		request:  models.MessageBatchRequest{},
+		response: []*models.MessageBatchResult{},
+	},
+	"GET /messages/export": {
+		summary: "Export all messages with the deleted ones as json lines or csv",
+		tag:     "Messages",
+		auth:    true,
+		query: []*openapi.Parameter{
+			formatParam,
+			{Name: "since", Description: "only messages created since", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+			{Name: "until", Description: "only messages created before", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		},
+		response:    models.Message{},
+		contentType: archive.ContentType(archive.JSONLines),
+	},
+	"POST /messages/import": {
+		summary: "Import an export of json lines or csv in one transaction",
+		tag:     "Messages",
+		auth:    true,
+		query: []*openapi.Parameter{
+			formatParam,
+			{Name: "conflict", Description: "skip, overwrite or fail on existing ids, default fail", Schema: &openapi.Schema{Type: "string"}},
+		},
+		response: archive.Result{},
+	},
+	"POST /messages/from-template/{templateID}": {
+		summary:  "Create a message of a template and its variables",
+		tag:      "Messages",
+		auth:     true,
+		request:  models.TemplateMessageRequest{},
+		response: models.Message{},
+	},
+	"GET /messages/{messageID}": {
+		summary:  "Get a message",
+		tag:      "Messages",
+		auth:     true,
+		response: models.Message{},
+	},
+	"DELETE /messages/{messageID}": {
+		summary:  "Delete a message",
+		tag:      "Messages",
+		auth:     true,
+		response: models.Message{},
+	},
+	"GET /messages/{messageID}/deliveries": {
+		summary:  "Get the relay deliveries of a message",
+		tag:      "Messages",
+		auth:     true,
+		response: []*models.Delivery{},
+	},
+	"GET /templates": {
+		summary:  "Get all message templates",
+		tag:      "Templates",
+		auth:     true,
+		response: []*models.Template{},
+	},
+	"POST /templates": {
+		summary:  "Create a message template",
+		tag:      "Templates",
+		auth:     true,
+		request:  models.TemplateRequest{},
+		response: models.Template{},
+	},
+	"GET /templates/{templateID}": {
+		summary:  "Get a message template",
+		tag:      "Templates",
+		auth:     true,
+		response: models.Template{},
+	},
+	"PUT /templates/{templateID}": {
+		summary:  "Replace a message template",
+		tag:      "Templates",
+		auth:     true,
+		request:  models.TemplateRequest{},
+		response: models.Template{},
+	},
+	"DELETE /templates/{templateID}": {
+		summary:  "Delete a message template",
+		tag:      "Templates",
+		auth:     true,
+		response: models.Template{},
+	},
+	"GET /schedules": {
+		summary:  "Get all recurring messages",
+		tag:      "Schedules",
+		auth:     true,
+		response: []*models.Schedule{},
+	},
+	"POST /schedules": {
+		summary:  "Create a recurring message",
+		tag:      "Schedules",
+		auth:     true,
+		request:  models.ScheduleRequest{},
+		response: models.Schedule{},
+	},
+	"GET /schedules/{scheduleID}": {
+		summary:  "Get a recurring message",
+		tag:      "Schedules",
+		auth:     true,
+		response: models.Schedule{},
+	},
+	"PUT /schedules/{scheduleID}": {
+		summary:  "Replace a recurring message",
+		tag:      "Schedules",
+		auth:     true,
+		request:  models.ScheduleRequest{},
+		response: models.Schedule{},
+	},
+	"DELETE /schedules/{scheduleID}": {
+		summary:  "Delete a recurring message",
+		tag:      "Schedules",
+		auth:     true,
+		response: models.Schedule{},
+	},
+	"POST /schedules/{scheduleID}/pause": {
+		summary:  "Pause a recurring message",
+		tag:      "Schedules",
+		auth:     true,
+		response: models.Schedule{},
+	},
+	"POST /schedules/{scheduleID}/resume": {
+		summary:  "Resume a recurring message, skipping the occurrences during the pause",
+		tag:      "Schedules",
+		auth:     true,
+		response: models.Schedule{},
+	},
+	"GET /schedules/{scheduleID}/preview": {
+		summary: "Get the upcoming occurrences of a recurring message",
+		tag:     "Schedules",
+		auth:    true,
+		query: []*openapi.Parameter{
+			{Name: "count", Description: "occurrences, default 5", Schema: &openapi.Schema{Type: "integer", Minimum: number(1), Maximum: number(maxPerPage)}},
+		},
+		response: []time.Time{},
+	},
+	"GET /subscribers": {
+		summary:  "Get all mail subscribers",
+		tag:      "Subscribers",
+		auth:     true,
+		response: []*models.Subscriber{},
+	},
+	"POST /subscribers": {
+		summary:  "Subscribe to messages by mail",
+		tag:      "Subscribers",
+		request:  models.SubscriberRequest{},
+		status:   http.StatusAccepted,
+		response: models.SubscriberRequest{},
+	},
+	"GET /subscribers/confirm": {
+		summary:  "Confirm a subscription",
+		tag:      "Subscribers",
+		query:    []*openapi.Parameter{tokenParam},
+		response: models.SubscriberRequest{},
+	},
+	"GET /subscribers/unsubscribe": {
+		summary:  "Get the subscriber of an unsubscribe link, POST unsubscribes",
+		tag:      "Subscribers",
+		query:    []*openapi.Parameter{tokenParam},
+		response: models.SubscriberRequest{},
+	},
+	"POST /subscribers/unsubscribe": {
+		summary:  "Unsubscribe from messages with one click",
+		tag:      "Subscribers",
+		query:    []*openapi.Parameter{tokenParam},
+		response: models.SubscriberRequest{},
+	},
+	"GET /relays": {
+		summary:  "Get the status of the relays",
+		tag:      "Relays",
+		auth:     true,
+		response: []relay.Status{},
+	},
+	"GET /openapi.json": {
+		summary:  "Get this document",
+		tag:      "Meta",
+		response: map[string]interface{}{},
+	},
+	"GET /healthz": {
+		summary:  "Check if the process is alive",
+		tag:      "Health",
+		response: health{},
+	},
+	"GET /readyz": {
+		summary:  "Check if the database is reachable and migrated",
+		tag:      "Health",
+		response: health{},
+	},
+	"GET /version": {
+		summary:  "Get the version of the build",
+		tag:      "Meta",
+		response: version.Info{},
+	},
+	"GET /.well-known/webfinger": {
+		summary:     "Find the activitypub actor",
+		tag:         "ActivityPub",
+		query:       []*openapi.Parameter{{Name: "resource", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+		response:    activitypub.WebFinger{},
+		contentType: "application/jrd+json",
+	},
+	"GET /ap/actor": {
+		summary:     "Get the activitypub actor",
+		tag:         "ActivityPub",
+		response:    activitypub.Actor{},
+		contentType: activitypub.ContentType,
+	},
+	"GET /ap/outbox": {
+		summary:     "Get the latest messages as activities",
+		tag:         "ActivityPub",
+		response:    activitypub.OrderedCollection{},
+		contentType: activitypub.ContentType,
+	},
+	"GET /ap/followers": {
+		summary:     "Get the number of followers",
+		tag:         "ActivityPub",
+		response:    activitypub.OrderedCollection{},
+		contentType: activitypub.ContentType,
+	},
+	"POST /ap/inbox": {
+		summary:     "Receive a signed activity",
+		tag:         "ActivityPub",
+		request:     activitypub.IncomingActivity{},
+		status:      http.StatusAccepted,
+		contentType: activitypub.ContentType,
+	},
+	"GET /ap/notes/{messageID}": {
+		summary:     "Get a message as note",
+		tag:         "ActivityPub",
+		response:    activitypub.Note{},
+		contentType: activitypub.ContentType,
+	},
+}
+
+// maxPerPage of paginated lists
+const maxPerPage = 100
+
+// formatParam of archives
+var formatParam = &openapi.Parameter{Name: "format", Description: "jsonl or csv, default jsonl", Schema: &openapi.Schema{Type: "string"}}
+
+// tokenParam of the subscriber links
+var tokenParam = &openapi.Parameter{Name: "token", Required: true, Schema: &openapi.Schema{Type: "string"}}
+
+// pathParams are the schemas of the url params shared by all routes
+var pathParams = map[string]*openapi.Schema{
+	"messageID":  {Type: "string", Format: "uuid"},
+	"templateID": {Type: "string", Format: "uuid"},
+	"scheduleID": {Type: "string", Format: "uuid"},
+}
+
+var pathParam = regexp.MustCompile(`{([^}]+)}`)
+
+// routePath turns a route pattern into the path of the document
+func routePath(pattern string) string {
+	// the pattern keeps the wildcard of mounted sub routers
+	path := strings.Replace(pattern, "/*/", "/", -1)
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	return path
+}
+
+// openAPI generates the openapi document of all routes of the router
+func openAPI(r *router.Router) (*openapi.Document, error) {
+	schemas := openapi.Schemas{}
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "MOC API",
+			Description: "Message Operator Center",
+			Contact: &openapi.Contact{
+				Name:  "Chaostreff Flensburg e.V.",
+				URL:   "https://chaostreff-flensburg.de",
+				Email: "mail@chaostreff-flensburg.de",
+			},
+			Version: "1.0.0",
+		},
+		Paths: map[string]*openapi.PathItem{},
+		Components: openapi.Components{
+			Schemas: schemas,
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"operatorAuth": {Type: "http", Scheme: "bearer", BearerFormat: "Token"},
+			},
+		},
+	}
+
+	errorResponse := &openapi.Response{
+		Description: "Error",
+		Content: map[string]*openapi.MediaType{
+			"application/json":        {Schema: schemas.For(router.HTTPError{})},
+			router.ProblemContentType: {Schema: schemas.For(router.Problem{})},
+		},
+	}
+
+	err := r.Walk(func(method string, route string) error {
+		path := routePath(route)
+
+		op, ok := operations[method+" "+path]
+		if !ok {
+			return fmt.Errorf("route %s %s is not documented", method, path)
+		}
+
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		operation := &openapi.Operation{
+			Tags:        []string{op.tag},
+			Summary:     op.summary,
+			OperationID: operationID(method, path),
+			Responses: map[string]*openapi.Response{
+				"default": errorResponse,
+			},
+		}
+
+		if op.auth {
+			operation.Security = []map[string][]string{{"operatorAuth": {}}}
+		}
+
+		for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+			schema, ok := pathParams[match[1]]
+			if !ok {
+				schema = &openapi.Schema{Type: "string"}
+			}
+
+			operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+				Schema:   schema,
+			})
+		}
+
+		for _, param := range op.query {
+			query := *param
+			query.In = "query"
+			operation.Parameters = append(operation.Parameters, &query)
+		}
+
+		if op.request != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					contentType: {Schema: schemas.For(op.request)},
+				},
+			}
+		}
+
+		response := &openapi.Response{Description: http.StatusText(status)}
+		if op.response != nil {
+			response.Content = map[string]*openapi.MediaType{
+				contentType: {Schema: schemas.For(op.response)},
+			}
+		}
+		operation.Responses[strconv.Itoa(status)] = response
+
+		doc.AddOperation(method, path, operation)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func number(n float64) *float64 {
+	return &n
+}
+
+// operationID like getMessagesMessageIDDeliveries
+func operationID(method string, path string) string {
+	parts := strings.FieldsFunc(path, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	})
+
+	id := strings.ToLower(method)
+	for _, part := range parts {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return id
+}
+
+// getOpenAPI delivers the openapi document of this api
+func (api *API) getOpenAPI(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, api.openAPI)
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+
+	w := apiTest.Request("GET", "/openapi.json", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	doc := &openapi.Document{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(doc))
+
+	// every documented operation has a route
+	for route := range operations {
+		parts := strings.SplitN(route, " ", 2)
+		assert.NotNil(t, doc.Operation(parts[0], parts[1]), "%s has no route", route)
+	}
+
+	message := doc.Components.Schemas["Message"]
+	require.NotNil(t, message)
+	assert.Equal(t, "string", message.Properties["id"].Type)
+	assert.Equal(t, "uuid", message.Properties["id"].Format)
+	assert.Equal(t, 160, *message.Properties["message"].MaxLength)
+
+	httpError := doc.Components.Schemas["HTTPError"]
+	require.NotNil(t, httpError)
+	assert.Equal(t, []string{"object", "code", "msg", "json"}, httpError.Required)
+	assert.Contains(t, httpError.Properties, "error_id")
+}
+
+// TestOpenAPIResponses calls every route and checks the response against the
+// document, so handlers and document can't drift apart
+func TestOpenAPIResponses(t *testing.T) {
+	apiTest := newActivityPubTest(t)
+	defer os.RemoveAll(filepath.Dir(apiTest.Config.ActivityPub.KeyPath))
+
+	api := NewAPI(apiTest.DB, apiTest.Config)
+	doc := api.openAPI
+
+	message := models.NewMessage("Hackspace is open")
+	require.NoError(t, apiTest.DB.Create(message).Error)
+
+	// deleted by the bulk delete
+	outdated := models.NewMessage("Hackspace is closed")
+	require.NoError(t, apiTest.DB.Create(outdated).Error)
+
+	template := &models.Template{TemplateRequest: models.TemplateRequest{Name: "talk", Text: "Talk {title} starts"}}
+	require.NoError(t, apiTest.DB.Create(template).Error)
+
+	schedule := &models.Schedule{ScheduleRequest: models.ScheduleRequest{MessageRequest: models.MessageRequest{Text: "Hackspace closes in 30 minutes"}, Cron: "30 23 * * *"}}
+	require.NoError(t, apiTest.DB.Create(schedule).Error)
+
+	subscribers := map[string]*models.Subscriber{}
+	for _, route := range []string{"GET /subscribers/confirm", "GET /subscribers/unsubscribe", "POST /subscribers/unsubscribe"} {
+		subscriber := models.NewSubscriber(strings.Replace(strings.ToLower(route), " /subscribers/", "-", 1) + "@example.com")
+		require.NoError(t, apiTest.DB.Create(subscriber).Error)
+		subscribers[route] = subscriber
+	}
+
+	bodies := map[string]interface{}{
+		"POST /messages":                            models.MessageRequest{Text: "Hackspace is closed"},
+		"POST /messages/batch":                      models.MessageBatchRequest{Messages: []models.MessageRequest{{Text: "Hackspace is open"}, {Text: "Hackspace is closed"}}},
+		"POST /subscribers":                         models.SubscriberRequest{Email: "alice@example.com"},
+		"POST /templates":                           models.TemplateRequest{Name: "room", Text: "Talk {title} moves to {room}"},
+		"PUT /templates/{templateID}":               models.TemplateRequest{Name: "talk", Text: "Talk {title} starts now"},
+		"POST /schedules":                           models.ScheduleRequest{MessageRequest: models.MessageRequest{Text: "Doors open"}, Cron: "0 10 * * 6", TimeZone: "Europe/Berlin"},
+		"PUT /schedules/{scheduleID}":               models.ScheduleRequest{MessageRequest: models.MessageRequest{Text: "Hackspace closes in 15 minutes"}, Cron: "45 23 * * *"},
+		"POST /messages/from-template/{templateID}": models.TemplateMessageRequest{Variables: map[string]string{"title": "Go"}},
+		"POST /ap/inbox": map[string]string{
+			"id":     "https://remote.example/follow/1",
+			"type":   "Follow",
+			"actor":  "https://remote.example/actor",
+			"object": api.activityPub.ActorID(),
+		},
+	}
+
+	// unsigned activities are rejected
+	failing := map[string]int{
+		"POST /ap/inbox": http.StatusUnauthorized,
+	}
+
+	routes := []string{}
+	for path, item := range doc.Paths {
+		for method := range *item {
+			routes = append(routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	// delete the message last
+	sort.Slice(routes, func(i, j int) bool {
+		deleteI, deleteJ := strings.HasPrefix(routes[i], "DELETE"), strings.HasPrefix(routes[j], "DELETE")
+		if deleteI != deleteJ {
+			return deleteJ
+		}
+		return routes[i] < routes[j]
+	})
+
+	for _, route := range routes {
+		parts := strings.SplitN(route, " ", 2)
+		operation := doc.Operation(parts[0], parts[1])
+
+		// streams are tested against a real server or on their own
+		if response, ok := operation.Responses["200"]; ok && (response.Content["text/event-stream"] != nil || response.Content["application/x-ndjson"] != nil) {
+			continue
+		}
+
+		path := strings.Replace(parts[1], "{messageID}", message.ID, 1)
+		path = strings.Replace(path, "{templateID}", template.ID, 1)
+		path = strings.Replace(path, "{scheduleID}", schedule.ID, 1)
+
+		query := url.Values{}
+		for _, parameter := range operation.Parameters {
+			switch parameter.Name {
+			case "token":
+				query.Set("token", subscribers[route].Token)
+			case "ids":
+				query.Set("ids", outdated.ID)
+			case "resource":
+				query.Set("resource", api.activityPub.Account())
+			}
+		}
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+
+		w := apiTest.Request(parts[0], path, bodies[route])
+
+		if status, ok := failing[route]; ok {
+			assert.Equal(t, status, w.Code, route)
+		} else {
+			assert.True(t, w.Code < 300, "%s responds %d: %s", route, w.Code, w.Body.String())
+		}
+
+		response, ok := operation.Responses[strconv.Itoa(w.Code)]
+		if !ok {
+			response = operation.Responses["default"]
+		}
+		require.NotNil(t, response, route)
+
+		if response.Content == nil {
+			assert.Empty(t, w.Body.String(), route)
+			continue
+		}
+
+		contentType := w.Header().Get("Content-Type")
+		media, ok := response.Content[contentType]
+		if !assert.True(t, ok, "%s responds with undocumented %s", route, contentType) {
+			continue
+		}
+
+		errors := doc.ValidateJSON(media.Schema, w.Body.Bytes())
+		assert.Nil(t, errors, "%s responds %s", route, w.Body.String())
+	}
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	testCases := []struct {
+		name    string
+		method  string
+		url     string
+		data    interface{}
+		exepted router.HTTPError
+	}{{
+		name:    "wrong type",
+		method:  "POST",
+		url:     "/messages",
+		data:    map[string]interface{}{"message": 42},
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"message": "type"}).WithMessages(map[string]string{"message": "message has the wrong type"}),
+	}, {
+		name:    "broken json",
+		method:  "POST",
+		url:     "/messages",
+		data:    json.RawMessage(`{"message": `),
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"body": "json"}).WithMessages(map[string]string{"body": "body is no valid json"}),
+	}, {
+		name:    "no json body",
+		method:  "POST",
+		url:     "/subscribers",
+		data:    "alice@example.com",
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"body": "type"}).WithMessages(map[string]string{"body": "body has the wrong type"}),
+	}, {
+		name:    "bad email",
+		method:  "POST",
+		url:     "/subscribers",
+		data:    models.SubscriberRequest{Email: "alice"},
+		exepted: *router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithJsonError(map[string]interface{}{"email": "email"}).WithMessages(map[string]string{"email": "email must be a valid email address"}),
+	}, {
+		name:    "missing query param",
+		method:  "GET",
+		url:     "/subscribers/confirm",
+		exepted: *router.BadRequestError("bad token").WithCode(router.CodeInvalidParameter).WithJsonError(map[string]interface{}{"token": "required"}).WithMessages(map[string]string{"token": "token is required"}),
+	}, {
+		name:    "bad path param",
+		method:  "GET",
+		url:     "/messages/1/deliveries",
+		exepted: *router.BadRequestError("bad messageID").WithCode(router.CodeInvalidParameter).WithJsonError(map[string]interface{}{"messageID": "uuid"}).WithMessages(map[string]string{"messageID": "messageID must be a valid uuid"}),
+	}}
+
+	for _, testCase := range testCases {
+		w := apiTest.Request(testCase.method, testCase.url, testCase.data)
+		assert.Equal(t, http.StatusBadRequest, w.Code, testCase.name)
+
+		var err router.HTTPError
+		json.NewDecoder(w.Body).Decode(&err)
+		assert.Equal(t, testCase.exepted, err, testCase.name)
+	}
+}
+
+func TestValidationAfterAuth(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	// a broken body of an unauthenticated client does not reveal the schema
+	r := httptest.NewRequest("POST", "/messages", strings.NewReader(`{"message": 42}`))
+	r.Header.Set("Authorization", "Basic secret")
+	w := httptest.NewRecorder()
+	api.handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "wrong type")
+
+	w = apiTest.Request("POST", "/messages", models.MessageRequest{Text: strings.Repeat("a", maxBodySize)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, router.CodeTooLarge, err.ErrorCode)
+}
+
+func TestLocalizedValidation(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	testCases := []struct {
+		url      string
+		body     string
+		messages map[string]string
+	}{{
+		url:      "/messages",
+		body:     `{"message": "Hi"}`,
+		messages: map[string]string{"message": "message muss mindestens 3 Zeichen lang sein"},
+	}, {
+		url:      "/messages?per_page=1000&page=0",
+		messages: map[string]string{"page": "page muss mindestens 1 sein", "per_page": "per_page darf höchstens 100 sein"},
+	}}
+
+	for _, testCase := range testCases {
+		method := "GET"
+		if testCase.body != "" {
+			method = "POST"
+		}
+
+		r := httptest.NewRequest(method, testCase.url, strings.NewReader(testCase.body))
+		r.Header.Set("Accept-Language", "de-DE,de;q=0.9,en;q=0.8")
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, r)
+		require.Equal(t, http.StatusBadRequest, w.Code, testCase.url)
+
+		// the rules stay in json for clients
+		var err router.HTTPError
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+		assert.Len(t, err.Json, len(testCase.messages), testCase.url)
+		assert.Equal(t, testCase.messages, err.Messages, testCase.url)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestProblemResponses(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	testCases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		accept string
+		status int
+		code   string
+		params []router.InvalidParam
+	}{{
+		name:   "not found",
+		method: "GET",
+		url:    "/messages/6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		accept: "application/problem+json",
+		status: http.StatusNotFound,
+		code:   router.CodeMessageNotFound,
+	}, {
+		name:   "validation",
+		method: "POST",
+		url:    "/messages",
+		body:   `{"message": 42}`,
+		accept: "application/json;q=0.5, application/problem+json",
+		status: http.StatusBadRequest,
+		code:   router.CodeInvalidPayload,
+		params: []router.InvalidParam{{Name: "message", Reason: "type", Message: "message has the wrong type"}},
+	}, {
+		name:   "bad parameter",
+		method: "GET",
+		url:    "/subscribers/confirm",
+		accept: "application/problem+json",
+		status: http.StatusBadRequest,
+		code:   router.CodeInvalidParameter,
+		params: []router.InvalidParam{{Name: "token", Reason: "required", Message: "token is required"}},
+	}}
+
+	for _, testCase := range testCases {
+		r := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.body))
+		r.Header.Set("Accept", testCase.accept)
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, r)
+
+		require.Equal(t, testCase.status, w.Code, testCase.name)
+		assert.Equal(t, router.ProblemContentType, w.Header().Get("Content-Type"), testCase.name)
+
+		var problem router.Problem
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&problem), testCase.name)
+		assert.Equal(t, router.ProblemType(testCase.code), problem.Type, testCase.name)
+		assert.Equal(t, http.StatusText(testCase.status), problem.Title, testCase.name)
+		assert.Equal(t, testCase.status, problem.Status, testCase.name)
+		assert.Equal(t, testCase.code, problem.Code, testCase.name)
+		assert.Equal(t, r.URL.Path, problem.Instance, testCase.name)
+		assert.Equal(t, testCase.params, problem.InvalidParams, testCase.name)
+	}
+}
+
+func TestProblemNegotiation(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	// old clients keep the plain json errors, with the code added
+	for _, accept := range []string{"", "application/json", "application/problem+json;q=0"} {
+		r := httptest.NewRequest("GET", "/messages/6ba7b810-9dad-11d1-80b4-00c04fd430c8", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		api.handler.ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusNotFound, w.Code, accept)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"), accept)
+
+		var err router.HTTPError
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&err), accept)
+		assert.Equal(t, "message not found", err.Message, accept)
+		assert.Equal(t, router.CodeMessageNotFound, err.ErrorCode, accept)
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestRecoverer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	defer provider.Shutdown(context.Background())
+	otel.SetTracerProvider(provider)
+
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer meterProvider.Shutdown(context.Background())
+	otel.SetMeterProvider(meterProvider)
+
+	hook := logtest.NewLocal(logrus.StandardLogger())
+	defer hook.Reset()
+
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	api.router.Get("/panic", func(w http.ResponseWriter, r *http.Request) error {
+		panic("handler failed")
+	})
+
+	hook.Reset()
+
+	r := httptest.NewRequest("GET", "/panic", nil)
+	r.Header.Set("X-Request-ID", "request-1")
+	w := httptest.NewRecorder()
+
+	require.NotPanics(t, func() {
+		api.handler.ServeHTTP(w, r)
+	})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, "Internal Server Error", err.Message)
+	assert.Equal(t, "request-1", err.ErrorID)
+
+	// the panic is logged once, followed by the access log
+	entries := hook.AllEntries()
+	require.Len(t, entries, 2)
+	entry := entries[0]
+	assert.Equal(t, logrus.ErrorLevel, entry.Level)
+	assert.Equal(t, "panic: handler failed", entry.Message)
+	assert.Equal(t, "request-1", entry.Data["req_id"])
+	assert.Contains(t, entry.Data["stack"], "api.TestRecoverer")
+	assert.Equal(t, http.StatusInternalServerError, entries[1].Data["status"])
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+
+	// the panic is counted
+	metrics := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &metrics))
+	require.Len(t, metrics.ScopeMetrics, 1)
+	require.Len(t, metrics.ScopeMetrics[0].Metrics, 1)
+	counter := metrics.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "moc.http.server.panics", counter.Name)
+	sum := counter.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+
+	// the server keeps serving
+	w = httptest.NewRecorder()
+	api.handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRecovererAbort(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	api.router.Get("/abort", func(w http.ResponseWriter, r *http.Request) error {
+		panic(http.ErrAbortHandler)
+	})
+
+	// the server closes the connection without a response
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		api.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abort", nil))
+	})
+}
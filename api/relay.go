@@ -0,0 +1,12 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// getRelays delivers the status of all relays running in the server
+func (api *API) getRelays(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, api.dispatcher.Status(r.Context()))
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jinzhu/gorm"
+
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// defaultPreview of upcoming occurrences
+const defaultPreview = 5
+
+// withScheduleID load schedule entity by request param
+func (api *API) withScheduleID(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	scheduleID := chi.URLParam(r, "scheduleID")
+
+	var schedule models.Schedule
+	if res := api.database(r.Context()).First(&schedule, models.Schedule{ID: scheduleID}); res.Error != nil {
+		if gorm.IsRecordNotFoundError(res.Error) {
+			return nil, router.NotFoundError("schedule not found").WithCode(router.CodeScheduleNotFound)
+		}
+
+		return nil, router.HandleSQLError(res.Error)
+	}
+
+	return session.WithSchedule(r.Context(), &schedule), nil
+}
+
+// getSchedules delivers all schedules by their next occurrence
+func (api *API) getSchedules(w http.ResponseWriter, r *http.Request) error {
+	schedules := []*models.Schedule{}
+
+	if res := api.database(r.Context()).Order("next_run_at").Find(&schedules); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, schedules)
+}
+
+// createSchedule
+func (api *API) createSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := &models.Schedule{}
+
+	if err := api.decodeSchedule(r, schedule); err != nil {
+		return err
+	}
+
+	if res := api.database(r.Context()).Create(schedule); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, schedule)
+}
+
+// delivers schedule
+func (api *API) getSchedule(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, session.GetSchedule(r.Context()))
+}
+
+// updateSchedule replaces the definition, occurrences which are past stay
+// past. Only the definition is written, the run times of the scheduler are
+// left alone.
+func (api *API) updateSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := session.GetSchedule(r.Context())
+
+	if err := api.decodeSchedule(r, schedule); err != nil {
+		return err
+	}
+
+	return api.updateScheduleColumns(w, r, schedule, map[string]interface{}{
+		"text":        schedule.Text,
+		"cron":        schedule.Cron,
+		"time_zone":   schedule.TimeZone,
+		"start_at":    schedule.StartAt,
+		"end_at":      schedule.EndAt,
+		"next_run_at": schedule.NextRunAt,
+		"updated_at":  time.Now(),
+	})
+}
+
+// delete a schedule, it stays in the database for the messages it created
+func (api *API) deleteSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := session.GetSchedule(r.Context())
+
+	if res := api.database(r.Context()).Delete(schedule); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, schedule)
+}
+
+// pauseSchedule until it is resumed
+func (api *API) pauseSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := session.GetSchedule(r.Context())
+
+	return api.updateScheduleColumns(w, r, schedule, map[string]interface{}{
+		"paused":     true,
+		"updated_at": time.Now(),
+	})
+}
+
+// resumeSchedule with the next occurrence, the ones during the pause are
+// skipped. Resuming a running schedule keeps its next occurrence.
+func (api *API) resumeSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := session.GetSchedule(r.Context())
+
+	next, err := schedule.Next(time.Now())
+	if err != nil {
+		return router.InternalServerError("broken schedule").WithInternalError(err)
+	}
+
+	res := api.database(r.Context()).Model(&models.Schedule{}).Where("id = ? AND paused = ?", schedule.ID, true).UpdateColumns(map[string]interface{}{
+		"paused":      false,
+		"next_run_at": next,
+		"updated_at":  time.Now(),
+	})
+	if res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return api.sendSchedule(w, r, schedule.ID)
+}
+
+// updateScheduleColumns writes only the changed columns, so a concurrent
+// run of the scheduler is not overwritten, and sends the updated schedule
+func (api *API) updateScheduleColumns(w http.ResponseWriter, r *http.Request, schedule *models.Schedule, columns map[string]interface{}) error {
+	res := api.database(r.Context()).Model(&models.Schedule{}).Where("id = ?", schedule.ID).UpdateColumns(columns)
+	if res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return api.sendSchedule(w, r, schedule.ID)
+}
+
+// sendSchedule as it is in the database
+func (api *API) sendSchedule(w http.ResponseWriter, r *http.Request, id string) error {
+	schedule := &models.Schedule{}
+	if res := api.database(r.Context()).First(schedule, models.Schedule{ID: id}); res.Error != nil {
+		if gorm.IsRecordNotFoundError(res.Error) {
+			return router.NotFoundError("schedule not found").WithCode(router.CodeScheduleNotFound)
+		}
+
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, schedule)
+}
+
+// previewSchedule lists the upcoming occurrences in the time zone of the
+// schedule, paused or not
+func (api *API) previewSchedule(w http.ResponseWriter, r *http.Request) error {
+	schedule := session.GetSchedule(r.Context())
+
+	count := defaultPreview
+	if value := r.URL.Query().Get("count"); value != "" {
+		count, _ = strconv.Atoi(value)
+	}
+
+	occurrences, err := schedule.Upcoming(time.Now(), count)
+	if err != nil {
+		return router.InternalServerError("broken schedule").WithInternalError(err)
+	}
+
+	return router.SendJSON(w, http.StatusOK, occurrences)
+}
+
+// decodeSchedule of the body into a schedule and plan its next occurrence
+func (api *API) decodeSchedule(r *http.Request, schedule *models.Schedule) error {
+	request := models.ScheduleRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	if invalid := request.Validate(); invalid != nil {
+		return api.badPayload(r, openapi.Errors(*invalid))
+	}
+
+	next, err := request.Next(time.Now())
+	if err != nil {
+		return router.BadRequestError("bad schedule").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	schedule.ScheduleRequest = request
+	schedule.NextRunAt = next
+
+	return nil
+}
+
+// Created hands a message created outside of a request, like by the
+// scheduler, to the followers, relays and streams
+func (api *API) Created(message *models.Message) {
+	api.federate(api.jobsCtx, message)
+	api.publish(relay.Event{Type: relay.EventCreated, Message: message})
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestSchedules(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	start := time.Now().Add(-time.Hour)
+	end := start.Add(-time.Minute)
+	request := models.ScheduleRequest{
+		MessageRequest: models.MessageRequest{Text: "Hackspace closes in 30 minutes"},
+		Cron:           "30 23 * *",
+		TimeZone:       "Europe/Flensburg",
+		StartAt:        &start,
+		EndAt:          &end,
+	}
+
+	w := apiTest.Request("POST", "/schedules", request)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, map[string]interface{}{"cron": "cron", "time_zone": "time_zone", "end_at": "after_start"}, err.Json)
+	assert.Equal(t, "time_zone must be a time zone like Europe/Berlin", err.Messages["time_zone"])
+
+	// descriptors could fire every second
+	for _, spec := range []string{"@every 1s", "@hourly", "CRON_TZ=Europe/Berlin 30 23 * * *", "0 30 23 * * *"} {
+		request.Cron = spec
+		w = apiTest.Request("POST", "/schedules", request)
+		require.Equal(t, http.StatusBadRequest, w.Code, spec)
+
+		err = router.HTTPError{}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+		assert.Equal(t, "cron", err.Json.(map[string]interface{})["cron"], spec)
+	}
+
+	request.Cron = "30 23 * * *"
+	request.TimeZone = "Europe/Berlin"
+	request.EndAt = nil
+
+	w = apiTest.Request("POST", "/schedules", request)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	schedule := &models.Schedule{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	require.NotNil(t, schedule.NextRunAt)
+	assert.True(t, schedule.NextRunAt.After(time.Now()))
+
+	w = apiTest.Request("GET", "/schedules/"+schedule.ID+"/preview?count=3", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var occurrences []time.Time
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&occurrences))
+	require.Len(t, occurrences, 3)
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	for i, occurrence := range occurrences {
+		assert.Equal(t, 23, occurrence.In(berlin).Hour())
+		assert.Equal(t, 30, occurrence.Minute())
+		if i > 0 {
+			assert.True(t, occurrence.After(occurrences[i-1]))
+		}
+	}
+	assert.True(t, occurrences[0].Equal(*schedule.NextRunAt))
+
+	// the scheduler fired meanwhile, resuming a running schedule and
+	// pausing it keep its run times
+	lastRun := occurrences[0]
+	nextRun := occurrences[1].UTC()
+	require.NoError(t, apiTest.DB.Model(&models.Schedule{}).Where("id = ?", schedule.ID).UpdateColumns(map[string]interface{}{
+		"last_run_at": lastRun,
+		"next_run_at": nextRun,
+	}).Error)
+
+	w = apiTest.Request("POST", "/schedules/"+schedule.ID+"/resume", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	assert.True(t, nextRun.Equal(*schedule.NextRunAt))
+
+	w = apiTest.Request("POST", "/schedules/"+schedule.ID+"/pause", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	assert.True(t, schedule.Paused)
+	assert.True(t, lastRun.Equal(*schedule.LastRunAt))
+	assert.True(t, nextRun.Equal(*schedule.NextRunAt))
+
+	w = apiTest.Request("POST", "/schedules/"+schedule.ID+"/resume", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	assert.False(t, schedule.Paused)
+	assert.True(t, occurrences[0].Equal(*schedule.NextRunAt))
+
+	// an update replaces the definition and keeps the last run
+	request.Cron = "0 18 * * *"
+	request.EndAt = nil
+	w = apiTest.Request("PUT", "/schedules/"+schedule.ID, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	assert.Equal(t, "0 18 * * *", schedule.Cron)
+	assert.Equal(t, 18, schedule.NextRunAt.In(berlin).Hour())
+	assert.True(t, lastRun.Equal(*schedule.LastRunAt))
+
+	end = time.Now().Add(365 * 24 * time.Hour)
+	request.EndAt = &end
+	w = apiTest.Request("PUT", "/schedules/"+schedule.ID, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	require.NotNil(t, schedule.EndAt)
+
+	request.EndAt = nil
+	w = apiTest.Request("PUT", "/schedules/"+schedule.ID, request)
+	require.Equal(t, http.StatusOK, w.Code)
+	schedule = &models.Schedule{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(schedule))
+	assert.Nil(t, schedule.EndAt)
+
+	w = apiTest.Request("DELETE", "/schedules/"+schedule.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = apiTest.Request("POST", "/schedules/"+schedule.ID+"/resume", nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, router.CodeScheduleNotFound, err.ErrorCode)
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ListenAndServe serves the api on all configured addresses until Shutdown
+func (api *API) ListenAndServe() error {
+	api.log.Info("Start App...")
+
+	if api.config.Server.TLSCert != "" {
+		certificate, err := loadCertificate(api.config.Server.TLSCert, api.config.Server.TLSKey)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		api.server.RegisterOnShutdown(cancel)
+		go certificate.reloadOnHangup(ctx, api.log)
+
+		api.server.TLSConfig = &tls.Config{GetCertificate: certificate.get}
+	}
+
+	mode, err := strconv.ParseUint(api.config.Server.SocketMode, 8, 32)
+	if err != nil {
+		return errors.Wrap(err, "bad socket mode")
+	}
+
+	listeners := []net.Listener{}
+	for _, address := range api.config.Addresses() {
+		listener, err := listen(address, os.FileMode(mode))
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return api.serve(listeners)
+}
+
+// serve on all listeners, a failing listener closes the server
+func (api *API) serve(listeners []net.Listener) error {
+	// serving sets up a tls config for http/2
+	secure := api.server.TLSConfig != nil
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		api.log.Infof("Listen on %s", listenerURL(listener, secure))
+
+		go func(listener net.Listener) {
+			if secure {
+				errs <- api.server.ServeTLS(listener, "", "")
+			} else {
+				errs <- api.server.Serve(listener)
+			}
+		}(listener)
+	}
+
+	if err := <-errs; err != http.ErrServerClosed {
+		api.server.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown stops accepting connections, ends the streams and waits for the
+// running requests, connections still open once the context ends are closed
+func (api *API) Shutdown(ctx context.Context) error {
+	if err := api.server.Shutdown(ctx); err != nil {
+		api.server.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Drain waits for the background jobs of handled requests, jobs still
+// running once the context ends are canceled
+func (api *API) Drain(ctx context.Context) error {
+	defer api.cancelJobs()
+
+	done := make(chan struct{})
+	go func() {
+		api.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		api.cancelJobs()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// background runs a job which outlives its request, like the delivery to
+// remote servers
+func (api *API) background(job func(ctx context.Context)) {
+	api.jobs.Add(1)
+	go func() {
+		defer api.jobs.Done()
+		job(api.jobsCtx)
+	}()
+}
+
+// listen on a tcp address or on a unix socket with the prefix unix:
+func listen(address string, mode os.FileMode) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		listener, err := net.Listen("tcp", address)
+		return listener, errors.Wrapf(err, "listen on %s", address)
+	}
+
+	path := strings.TrimPrefix(address, "unix:")
+
+	// a socket left by a crashed server blocks the address
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err != nil {
+			os.Remove(path)
+		} else {
+			conn.Close()
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listen on %s", address)
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, errors.Wrapf(err, "chmod %s", path)
+	}
+
+	return listener, nil
+}
+
+// listenerURL for the log
+func listenerURL(listener net.Listener, secure bool) string {
+	addr := listener.Addr()
+	if addr.Network() == "unix" {
+		return "unix:" + addr.String()
+	}
+
+	if secure {
+		return "https://" + addr.String()
+	}
+	return "http://" + addr.String()
+}
+
+// certificate of the server, it is reloaded without a restart when it is
+// renewed
+type certificate struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// loadCertificate from a pem encoded certificate and key
+func loadCertificate(certFile string, keyFile string) (*certificate, error) {
+	c := &certificate{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// reload the files, the old certificate is kept if they are broken
+func (c *certificate) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "load tls certificate")
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	return nil
+}
+
+// get is the GetCertificate of the tls config
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.cert, nil
+}
+
+// reloadOnHangup reloads the certificate on every SIGHUP
+func (c *certificate) reloadOnHangup(ctx context.Context, log *logrus.Entry) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := c.reload(); err != nil {
+				log.WithError(err).Error("tls certificate not reloaded")
+				continue
+			}
+			log.Info("tls certificate reloaded")
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCertificate creates a self signed certificate for localhost
+func writeCertificate(t *testing.T, certFile string, keyFile string, name string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, ioutil.WriteFile(certFile, certPEM, 0644))
+	require.NoError(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+}
+
+func TestListenAndServe(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	dir, err := ioutil.TempDir("", "moc-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "moc.sock")
+
+	// a stale socket of a crashed server is replaced
+	stale, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	// find a free port
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := tcp.Addr().String()
+	tcp.Close()
+
+	config := *apiTest.Config
+	config.Server.Listen = address + ",unix:" + socket
+	config.Server.SocketMode = "0600"
+
+	api := NewAPI(apiTest.DB, &config)
+
+	done := make(chan error)
+	go func() {
+		done <- api.ListenAndServe()
+	}()
+
+	unix := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	get := func(client *http.Client, url string) error {
+		var err error
+		for i := 0; i < 100; i++ {
+			var res *http.Response
+			if res, err = client.Get(url); err == nil {
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					return assert.AnError
+				}
+				return nil
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return err
+	}
+
+	require.NoError(t, get(http.DefaultClient, "http://"+address+"/messages"))
+	require.NoError(t, get(unix, "http://moc/messages"))
+
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	require.NoError(t, api.Shutdown(context.Background()))
+	require.NoError(t, <-done)
+}
+
+func TestShutdown(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	api := NewAPI(apiTest.DB, apiTest.Config)
+	server := httptest.NewUnstartedServer(nil)
+	server.Config = api.server
+	server.Start()
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/messages/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	finished := false
+	api.background(func(ctx context.Context) {
+		time.Sleep(50 * time.Millisecond)
+		finished = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// open streams don't hold up the shutdown
+	require.NoError(t, api.Shutdown(ctx))
+	require.NoError(t, ctx.Err())
+
+	_, err = ioutil.ReadAll(res.Body)
+	assert.NoError(t, err, "stream is closed cleanly")
+
+	// background jobs are finished after the requests
+	require.NoError(t, api.Drain(ctx))
+	assert.True(t, finished)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+	api := NewAPI(apiTest.DB, apiTest.Config)
+
+	canceled := make(chan bool, 1)
+	api.background(func(ctx context.Context) {
+		select {
+		case <-ctx.Done():
+			canceled <- true
+		case <-time.After(5 * time.Second):
+			canceled <- false
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, api.Drain(ctx))
+	assert.True(t, <-canceled)
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	certificate, err := loadCertificate(certFile, keyFile)
+	require.NoError(t, err)
+
+	commonName := func() string {
+		cert, err := certificate.get(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return parsed.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	writeCertificate(t, certFile, keyFile, "renewed")
+	require.NoError(t, certificate.reload())
+	assert.Equal(t, "renewed", commonName())
+
+	// broken files keep the old certificate
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.Error(t, certificate.reload())
+	assert.Equal(t, "renewed", commonName())
+}
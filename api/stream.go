@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// keepAliveInterval of idle streams, proxies close silent connections
+const keepAliveInterval = 30 * time.Second
+
+// stream broadcasts message changes to all connected clients
+type stream struct {
+	mu          sync.Mutex
+	subscribers map[chan relay.Event]struct{}
+	closed      bool
+}
+
+func newStream() *stream {
+	return &stream{subscribers: map[chan relay.Event]struct{}{}}
+}
+
+func (s *stream) subscribe() chan relay.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(chan relay.Event, 16)
+	if s.closed {
+		close(events)
+		return events
+	}
+	s.subscribers[events] = struct{}{}
+
+	return events
+}
+
+func (s *stream) unsubscribe(events chan relay.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.subscribers, events)
+}
+
+// close ends all streams on shutdown, the clients reconnect to another
+// instance
+func (s *stream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for events := range s.subscribers {
+		close(events)
+		delete(s.subscribers, events)
+	}
+}
+
+// publish an event without blocking, slow clients miss events
+func (s *stream) publish(event relay.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// publish a message change to the relays and the stream
+func (api *API) publish(event relay.Event) {
+	api.dispatcher.Dispatch(event)
+	api.stream.publish(event)
+}
+
+// streamMessages sends message changes as server-sent events
+func (api *API) streamMessages(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return router.InternalServerError("streaming not supported").WithCode(router.CodeStreamingUnsupported)
+	}
+
+	events := api.stream.subscribe()
+	defer api.stream.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			data, err := json.Marshal(event.Message)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Message.ID, event.Type, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+
+		flusher.Flush()
+	}
+}
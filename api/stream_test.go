@@ -0,0 +1,48 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+func TestStreamMessages(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	server := httptest.NewServer(NewAPI(apiTest.DB, apiTest.Config).Handler())
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/messages/stream")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	req, _ := http.NewRequest("POST", server.URL+"/messages", strings.NewReader(`{"message": "Hackspace is open"}`))
+	created, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	created.Body.Close()
+
+	var message models.Message
+	apiTest.DB.First(&message)
+
+	reader := bufio.NewReader(res.Body)
+	lines := []string{}
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	assert.Equal(t, "id: "+message.ID, lines[0])
+	assert.Equal(t, "event: created", lines[1])
+	assert.Contains(t, lines[2], `"message":"Hackspace is open"`)
+}
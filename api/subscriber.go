@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// getSubscribers delivers all subscribers
+func (api *API) getSubscribers(w http.ResponseWriter, r *http.Request) error {
+	var subscribers []*models.Subscriber
+
+	if res := api.database(r.Context()).Find(&subscribers); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, subscribers)
+}
+
+// createSubscriber adds an unconfirmed subscriber, the mail relay will send
+// the confirmation link
+func (api *API) createSubscriber(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+
+	log := session.GetLogger(ctx)
+	log.Info("request createSubscriber")
+
+	request := models.SubscriberRequest{}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	request.Email = strings.ToLower(request.Email)
+
+	if invalid := request.Validate(); invalid != nil {
+		return api.badPayload(r, openapi.Errors(*invalid))
+	}
+
+	// the response is always the same to not reveal existing subscribers
+	var subscriber models.Subscriber
+	res := api.database(ctx).First(&subscriber, models.Subscriber{SubscriberRequest: request})
+	if gorm.IsRecordNotFoundError(res.Error) {
+		if res := api.database(ctx).Create(models.NewSubscriber(request.Email)); res.Error != nil {
+			return router.HandleSQLError(res.Error)
+		}
+	} else if res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusAccepted, request)
+}
+
+// confirmSubscriber by the token of the confirmation link
+func (api *API) confirmSubscriber(w http.ResponseWriter, r *http.Request) error {
+	subscriber, err := api.subscriberByToken(r)
+	if err != nil {
+		return err
+	}
+
+	if subscriber.ConfirmedAt == nil {
+		now := time.Now()
+		subscriber.ConfirmedAt = &now
+
+		if res := api.database(r.Context()).Save(subscriber); res.Error != nil {
+			return router.HandleSQLError(res.Error)
+		}
+	}
+
+	return router.SendJSON(w, http.StatusOK, subscriber.SubscriberRequest)
+}
+
+// confirmUnsubscribe shows the subscriber of the unsubscribe link, link
+// scanners of mail providers follow it, so it only deletes on POST
+func (api *API) confirmUnsubscribe(w http.ResponseWriter, r *http.Request) error {
+	subscriber, err := api.subscriberByToken(r)
+	if err != nil {
+		return err
+	}
+
+	return router.SendJSON(w, http.StatusOK, subscriber.SubscriberRequest)
+}
+
+// unsubscribe by the token of the unsubscribe link, the one-click POST of
+// RFC 8058
+func (api *API) unsubscribe(w http.ResponseWriter, r *http.Request) error {
+	subscriber, err := api.subscriberByToken(r)
+	if err != nil {
+		return err
+	}
+
+	if res := api.database(r.Context()).Delete(subscriber); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, subscriber.SubscriberRequest)
+}
+
+// subscriberByToken loads the subscriber of the token query param
+func (api *API) subscriberByToken(r *http.Request) (*models.Subscriber, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return nil, router.BadRequestError("bad token").WithCode(router.CodeSubscriberInvalidToken)
+	}
+
+	var subscriber models.Subscriber
+	if res := api.database(r.Context()).First(&subscriber, models.Subscriber{Token: token}); res.Error != nil {
+		if gorm.IsRecordNotFoundError(res.Error) {
+			return nil, router.NotFoundError("subscriber not found").WithCode(router.CodeSubscriberNotFound)
+		}
+
+		return nil, router.HandleSQLError(res.Error)
+	}
+
+	return &subscriber, nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+func TestSubscriberOptIn(t *testing.T) {
+	name := "TestSubscriberOptIn"
+	apiTest := NewAPITest(t, "http://localhost")
+
+	r := apiTest.Request("POST", "/subscribers", models.SubscriberRequest{Email: "no-mail"})
+	assert.Equal(t, http.StatusBadRequest, r.Code, fmt.Sprintf("%s > %s", name, "with wrong data"))
+
+	r = apiTest.Request("POST", "/subscribers", models.SubscriberRequest{Email: "Alice@example.com"})
+	assert.Equal(t, http.StatusAccepted, r.Code, fmt.Sprintf("%s > %s", name, "correct"))
+
+	// subscribing twice does not reveal the existing subscriber
+	r = apiTest.Request("POST", "/subscribers", models.SubscriberRequest{Email: "alice@example.com"})
+	assert.Equal(t, http.StatusAccepted, r.Code, fmt.Sprintf("%s > %s", name, "twice"))
+
+	var subscribers []models.Subscriber
+	apiTest.DB.Find(&subscribers)
+	assert.Len(t, subscribers, 1)
+	assert.Equal(t, "alice@example.com", subscribers[0].Email)
+	assert.Nil(t, subscribers[0].ConfirmedAt)
+
+	testCases := []struct {
+		name string
+		url  string
+		code int
+	}{{
+		name: "confirm with wrong token",
+		url:  "/subscribers/confirm?token=wrong",
+		code: http.StatusNotFound,
+	}, {
+		name: "confirm",
+		url:  "/subscribers/confirm?token=" + subscribers[0].Token,
+		code: http.StatusOK,
+	}}
+
+	for _, testCase := range testCases {
+		r := apiTest.Request("GET", testCase.url, nil)
+		assert.Equal(t, testCase.code, r.Code, fmt.Sprintf("%s > %s", name, testCase.name))
+	}
+
+	var subscriber models.Subscriber
+	apiTest.DB.First(&subscriber)
+	assert.NotNil(t, subscriber.ConfirmedAt)
+
+	// following the link keeps the subscriber
+	r = apiTest.Request("GET", "/subscribers/unsubscribe?token="+subscriber.Token, nil)
+	assert.Equal(t, http.StatusOK, r.Code, fmt.Sprintf("%s > %s", name, "unsubscribe link"))
+
+	var count int
+	apiTest.DB.Model(&models.Subscriber{}).Count(&count)
+	assert.Equal(t, 1, count)
+
+	// one-click unsubscribe
+	r = apiTest.Request("POST", "/subscribers/unsubscribe?token="+subscriber.Token, nil)
+	assert.Equal(t, http.StatusOK, r.Code, fmt.Sprintf("%s > %s", name, "unsubscribe"))
+
+	apiTest.DB.Model(&models.Subscriber{}).Count(&count)
+	assert.Equal(t, 0, count)
+
+	r = apiTest.Request("GET", "/subscribers/unsubscribe", nil)
+	assert.Equal(t, http.StatusBadRequest, r.Code, fmt.Sprintf("%s > %s", name, "unsubscribe without token"))
+}
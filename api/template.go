@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jinzhu/gorm"
+
+	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/openapi"
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// withTemplateID load template entity by request param
+func (api *API) withTemplateID(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	templateID := chi.URLParam(r, "templateID")
+
+	var template models.Template
+	if res := api.database(r.Context()).First(&template, models.Template{ID: templateID}); res.Error != nil {
+		if gorm.IsRecordNotFoundError(res.Error) {
+			return nil, router.NotFoundError("template not found").WithCode(router.CodeTemplateNotFound)
+		}
+
+		return nil, router.HandleSQLError(res.Error)
+	}
+
+	return session.WithTemplate(r.Context(), &template), nil
+}
+
+// getTemplates delivers all templates by name
+func (api *API) getTemplates(w http.ResponseWriter, r *http.Request) error {
+	templates := []*models.Template{}
+
+	if res := api.database(r.Context()).Order("name").Find(&templates); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, templates)
+}
+
+// createTemplate
+func (api *API) createTemplate(w http.ResponseWriter, r *http.Request) error {
+	template := &models.Template{}
+
+	if err := api.decodeTemplate(r, &template.TemplateRequest); err != nil {
+		return err
+	}
+
+	if res := api.database(r.Context()).Create(template); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, template)
+}
+
+// delivers template
+func (api *API) getTemplate(w http.ResponseWriter, r *http.Request) error {
+	return router.SendJSON(w, http.StatusOK, session.GetTemplate(r.Context()))
+}
+
+// updateTemplate replaces the name and text, messages of the template keep
+// their text
+func (api *API) updateTemplate(w http.ResponseWriter, r *http.Request) error {
+	template := session.GetTemplate(r.Context())
+
+	if err := api.decodeTemplate(r, &template.TemplateRequest); err != nil {
+		return err
+	}
+
+	if res := api.database(r.Context()).Save(template); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, template)
+}
+
+// delete a template, it stays in the database for the messages it rendered
+func (api *API) deleteTemplate(w http.ResponseWriter, r *http.Request) error {
+	template := session.GetTemplate(r.Context())
+
+	if res := api.database(r.Context()).Delete(template); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	return router.SendJSON(w, http.StatusOK, template)
+}
+
+// decodeTemplate of the body and check the syntax of the text
+func (api *API) decodeTemplate(r *http.Request, request *models.TemplateRequest) error {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	if invalid := request.Validate(); invalid != nil {
+		return api.badPayload(r, openapi.Errors(*invalid))
+	}
+
+	return nil
+}
+
+// createMessageFromTemplate renders a template with the variables of the
+// body, the rendered text has to pass the rules of a message
+func (api *API) createMessageFromTemplate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	template := session.GetTemplate(ctx)
+
+	request := &models.TemplateMessageRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		return router.BadRequestError("bad payload").WithCode(router.CodeInvalidPayload).WithInternalError(err)
+	}
+
+	variables, err := template.Variables()
+	if err != nil {
+		return router.InternalServerError("broken template").WithInternalError(err)
+	}
+
+	errors := openapi.Errors{}
+	for _, name := range variables {
+		if _, ok := request.Variables[name]; !ok {
+			errors["variables."+name] = "required"
+		}
+	}
+	if len(errors) > 0 {
+		return api.badPayload(r, errors)
+	}
+
+	text, err := template.Render(request.Variables)
+	if err != nil {
+		return router.InternalServerError("broken template").WithInternalError(err)
+	}
+
+	message := models.NewMessage(text)
+	message.TemplateID = &template.ID
+	if invalid := message.Validate(); invalid != nil {
+		return api.badPayload(r, openapi.Errors(*invalid))
+	}
+
+	if res := api.database(ctx).Create(message); res.Error != nil {
+		return router.HandleSQLError(res.Error)
+	}
+
+	api.federate(ctx, message)
+	api.publish(relay.Event{Type: relay.EventCreated, Message: message})
+
+	return router.SendJSON(w, http.StatusOK, message)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+func TestTemplates(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	w := apiTest.Request("POST", "/templates", models.TemplateRequest{Name: "talk", Text: "Talk {title starts"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, map[string]interface{}{"text": "template"}, err.Json)
+
+	w = apiTest.Request("POST", "/templates", models.TemplateRequest{Name: "talk", Text: "Talk {title} starts in {room} {{live}}"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	template := &models.Template{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(template))
+	assert.NotEmpty(t, template.ID)
+
+	w = apiTest.Request("PUT", "/templates/"+template.ID, models.TemplateRequest{Name: "talk", Text: "Talk {title} starts in {room} at {time}"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = apiTest.Request("GET", "/templates", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	templates := []*models.Template{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&templates))
+	require.Len(t, templates, 1)
+	assert.Equal(t, "Talk {title} starts in {room} at {time}", templates[0].Text)
+
+	w = apiTest.Request("DELETE", "/templates/"+template.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = apiTest.Request("GET", "/templates/"+template.ID, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, router.CodeTemplateNotFound, err.ErrorCode)
+}
+
+func TestCreateMessageFromTemplate(t *testing.T) {
+	apiTest := NewAPITest(t, "http://localhost")
+
+	template := &models.Template{TemplateRequest: models.TemplateRequest{Name: "talk", Text: "Talk {title} starts in {room} {{live}}"}}
+	require.NoError(t, apiTest.DB.Create(template).Error)
+
+	fromTemplate := func(variables map[string]string) *httptest.ResponseRecorder {
+		return apiTest.Request("POST", "/messages/from-template/"+template.ID, models.TemplateMessageRequest{Variables: variables})
+	}
+
+	w := fromTemplate(map[string]string{"title": "Go"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	var err router.HTTPError
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, map[string]interface{}{"variables.room": "required"}, err.Json)
+
+	// the rendered text follows the rules of a message
+	w = fromTemplate(map[string]string{"title": strings.Repeat("Go", 80), "room": "A"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	err = router.HTTPError{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&err))
+	assert.Equal(t, map[string]interface{}{"message": "max"}, err.Json)
+	assert.Equal(t, map[string]string{"message": "message must be at most 160 characters long"}, err.Messages)
+
+	w = fromTemplate(map[string]string{"title": "Go {room}\nPRIVMSG #moc", "room": "A"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	message := &models.Message{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(message))
+	assert.Equal(t, "Talk Go {room} PRIVMSG #moc starts in A {live}", message.Text)
+	require.NotNil(t, message.TemplateID)
+	assert.Equal(t, template.ID, *message.TemplateID)
+
+	// deleted templates stay known to their messages
+	require.NoError(t, apiTest.DB.Delete(template).Error)
+	stored := &models.Message{}
+	require.NoError(t, apiTest.DB.First(stored, "id = ?", message.ID).Error)
+	assert.Equal(t, template.ID, *stored.TemplateID)
+
+	assert.Equal(t, http.StatusNotFound, fromTemplate(nil).Code)
+}
@@ -38,7 +38,7 @@ func NewAPITest(t *testing.T, baseURL string) *APITest {
 	db, _ := gorm.Open("sqlite3", "/tmp/test.db")
 
 	// migrate
-	db.AutoMigrate(&models.Message{})
+	db.AutoMigrate(models.All()...)
 
 	return &APITest{
 		BaseURL: baseURL,
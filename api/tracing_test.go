@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	defer provider.Shutdown(context.Background())
+	otel.SetTracerProvider(provider)
+
+	apiTest := NewAPITest(t, "http://localhost")
+	tracing.Instrument(apiTest.DB)
+
+	message := models.NewMessage("Hackspace is open")
+	require.NoError(t, apiTest.DB.Create(message).Error)
+
+	r := httptest.NewRequest("GET", "/messages/"+message.ID, nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("X-Request-ID", "request-1")
+	w := httptest.NewRecorder()
+
+	NewAPI(apiTest.DB, apiTest.Config).handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// the trace is passed on to the client
+	assert.True(t, strings.HasPrefix(w.Header().Get("traceparent"), "00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+	spans := exporter.GetSpans()
+
+	// queries without request like the one above are not traced
+	require.Len(t, spans, 2)
+	query, server := spans[0], spans[1]
+
+	assert.Equal(t, "GET /messages/{messageID}", server.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.String("http.route", "/messages/{messageID}"))
+	assert.Contains(t, server.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, server.Attributes, attribute.String("http.request.id", "request-1"))
+
+	assert.Equal(t, "gorm.query messages", query.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, attribute.String("db.system.name", "sqlite3"))
+}
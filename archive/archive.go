@@ -0,0 +1,362 @@
+// Package archive moves messages between instances as JSON Lines or CSV.
+// Ids and timestamps are kept, deleted messages included.
+package archive
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// Formats of an archive
+const (
+	JSONLines = "jsonl"
+	CSV       = "csv"
+)
+
+// Modes on an id which exists already
+const (
+	Skip      = "skip"
+	Overwrite = "overwrite"
+	Fail      = "fail"
+)
+
+// columns of the csv header, archives of older versions end after
+// deleted_at
+var columns = []string{"id", "message", "created_at", "updated_at", "deleted_at", "template_id", "schedule_id"}
+
+// minColumns of a csv archive
+const minColumns = 5
+
+// ContentType of a format for http responses
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/x-ndjson"
+}
+
+// ValidFormat checks if a format is supported
+func ValidFormat(format string) bool {
+	return format == JSONLines || format == CSV
+}
+
+// ValidMode checks if a conflict mode is supported
+func ValidMode(mode string) bool {
+	return mode == Skip || mode == Overwrite || mode == Fail
+}
+
+// Filter of the exported messages by the time they were created, zero times
+// don't filter
+type Filter struct {
+	Since time.Time
+	Until time.Time
+}
+
+// Export writes the messages one by one, so big archives don't fill the memory
+func Export(db *gorm.DB, w io.Writer, format string, filter Filter) (int, error) {
+	if !ValidFormat(format) {
+		return 0, fmt.Errorf("unknown format %s", format)
+	}
+
+	db = db.Unscoped().Model(&models.Message{})
+	if !filter.Since.IsZero() {
+		db = db.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		db = db.Where("created_at < ?", filter.Until)
+	}
+
+	rows, err := db.Order("created_at").Rows()
+	if err != nil {
+		return 0, errors.Wrap(err, "load messages")
+	}
+	defer rows.Close()
+
+	write := newWriter(w, format)
+	if err := write.header(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		message := &models.Message{}
+		if err := db.ScanRows(rows, message); err != nil {
+			return count, errors.Wrap(err, "load messages")
+		}
+
+		if err := write.message(message); err != nil {
+			return count, errors.Wrap(err, "write messages")
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, errors.Wrap(err, "load messages")
+	}
+
+	return count, write.flush()
+}
+
+// Result of an import
+type Result struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+}
+
+// ConflictError of an imported message with an id which exists already
+type ConflictError struct {
+	Entry int
+	ID    string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("entry %d: message %s exists", e.Entry, e.ID)
+}
+
+// Import reads all messages in one transaction, a broken entry or a conflict
+// in the mode fail imports nothing
+func Import(db *gorm.DB, r io.Reader, format string, mode string) (*Result, error) {
+	if !ValidFormat(format) {
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+	if !ValidMode(mode) {
+		return nil, fmt.Errorf("unknown conflict mode %s", mode)
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "begin import")
+	}
+
+	result, err := importMessages(tx, newReader(r, format), mode)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, errors.Wrap(err, "commit import")
+	}
+
+	return result, nil
+}
+
+func importMessages(tx *gorm.DB, read reader, mode string) (*Result, error) {
+	result := &Result{}
+
+	for entry := 1; ; entry++ {
+		message, err := read()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "entry %d", entry)
+		}
+
+		if message.ID == "" {
+			return nil, fmt.Errorf("entry %d: message without id", entry)
+		}
+		for _, id := range []*string{&message.ID, message.TemplateID, message.ScheduleID} {
+			if id == nil {
+				continue
+			}
+			if _, err := uuid.Parse(*id); err != nil {
+				return nil, fmt.Errorf("entry %d: bad id %s", entry, *id)
+			}
+		}
+		if invalid := message.Validate(); invalid != nil {
+			return nil, fmt.Errorf("entry %d: invalid message %v", entry, *invalid)
+		}
+
+		var count int
+		if err := tx.Unscoped().Model(&models.Message{}).Where("id = ?", message.ID).Count(&count).Error; err != nil {
+			return nil, errors.Wrapf(err, "entry %d", entry)
+		}
+
+		switch {
+		case count == 0:
+			if err := tx.Create(message).Error; err != nil {
+				return nil, errors.Wrapf(err, "entry %d", entry)
+			}
+			result.Created++
+		case mode == Skip:
+			result.Skipped++
+		case mode == Overwrite:
+			if err := tx.Unscoped().Model(message).UpdateColumns(map[string]interface{}{
+				"text":        message.Text,
+				"created_at":  message.CreatedAt,
+				"updated_at":  message.UpdatedAt,
+				"deleted_at":  message.DeletedAt,
+				"template_id": message.TemplateID,
+				"schedule_id": message.ScheduleID,
+			}).Error; err != nil {
+				return nil, errors.Wrapf(err, "entry %d", entry)
+			}
+			result.Overwritten++
+		default:
+			return nil, &ConflictError{Entry: entry, ID: message.ID}
+		}
+	}
+}
+
+// writer of a format
+type writer struct {
+	header  func() error
+	message func(*models.Message) error
+	flush   func() error
+}
+
+func newWriter(w io.Writer, format string) *writer {
+	if format == CSV {
+		c := csv.NewWriter(w)
+		return &writer{
+			header: func() error {
+				return c.Write(columns)
+			},
+			message: func(message *models.Message) error {
+				deletedAt := ""
+				if message.DeletedAt != nil {
+					deletedAt = formatTime(*message.DeletedAt)
+				}
+
+				return c.Write([]string{
+					message.ID,
+					message.Text,
+					formatTime(message.CreatedAt),
+					formatTime(message.UpdatedAt),
+					deletedAt,
+					optional(message.TemplateID),
+					optional(message.ScheduleID),
+				})
+			},
+			flush: func() error {
+				c.Flush()
+				return c.Error()
+			},
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	encoder := json.NewEncoder(b)
+	return &writer{
+		header: func() error {
+			return nil
+		},
+		message: func(message *models.Message) error {
+			return encoder.Encode(message)
+		},
+		flush: b.Flush,
+	}
+}
+
+// reader of a format returns io.EOF after the last message
+type reader func() (*models.Message, error)
+
+func newReader(r io.Reader, format string) reader {
+	if format == CSV {
+		c := csv.NewReader(r)
+		c.FieldsPerRecord = 0
+		header := false
+
+		return func() (*models.Message, error) {
+			record, err := c.Read()
+			if err != nil {
+				return nil, err
+			}
+			if len(record) != minColumns && len(record) != len(columns) {
+				return nil, fmt.Errorf("%d columns instead of %d", len(record), len(columns))
+			}
+
+			// the header is optional
+			if !header {
+				header = true
+				if record[0] == columns[0] {
+					if record, err = c.Read(); err != nil {
+						return nil, err
+					}
+				}
+			}
+
+			message := &models.Message{ID: record[0], MessageRequest: models.MessageRequest{Text: record[1]}}
+			if message.CreatedAt, err = parseTime(record[2]); err != nil {
+				return nil, errors.Wrap(err, "bad created_at")
+			}
+			if message.UpdatedAt, err = parseTime(record[3]); err != nil {
+				return nil, errors.Wrap(err, "bad updated_at")
+			}
+			if record[4] != "" {
+				deletedAt, err := parseTime(record[4])
+				if err != nil {
+					return nil, errors.Wrap(err, "bad deleted_at")
+				}
+				message.DeletedAt = &deletedAt
+			}
+			if len(record) == len(columns) {
+				message.TemplateID = nonEmpty(record[5])
+				message.ScheduleID = nonEmpty(record[6])
+			}
+
+			return message, nil
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	return func() (*models.Message, error) {
+		for scanner.Scan() {
+			// blank lines are allowed, like the last one
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			message := &models.Message{}
+			if err := json.Unmarshal(scanner.Bytes(), message); err != nil {
+				return nil, err
+			}
+			return message, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// optional value of a csv column, empty if not set
+func optional(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+// nonEmpty value of a csv column, nil if empty
+func nonEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
@@ -0,0 +1,178 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/models/modelstest"
+)
+
+func seed(t *testing.T, db *gorm.DB) []*models.Message {
+	messages := []*models.Message{}
+	for i, text := range []string{"Hackspace is open", "Talk at 8pm, \"Go\"", "Hackspace is closed"} {
+		message := models.NewMessage(text)
+		message.CreatedAt = time.Date(2019, 5, 1, i, 0, 0, 0, time.UTC)
+		message.UpdatedAt = message.CreatedAt.Add(time.Minute)
+		require.NoError(t, db.Create(message).Error)
+		messages = append(messages, message)
+	}
+
+	templateID, scheduleID := "0f8fad5b-d9cb-469f-a165-70867728950e", "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	messages[1].TemplateID = &templateID
+	messages[2].ScheduleID = &scheduleID
+	require.NoError(t, db.Save(messages[1]).Error)
+	require.NoError(t, db.Save(messages[2]).Error)
+
+	require.NoError(t, db.Delete(messages[2]).Error)
+	require.NoError(t, db.Unscoped().First(messages[2], "id = ?", messages[2].ID).Error)
+
+	return messages
+}
+
+func TestExportImport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := modelstest.Open(t, filepath.Join(dir, "source.db"))
+	defer source.Close()
+	messages := seed(t, source)
+
+	for _, format := range []string{JSONLines, CSV} {
+		archive := &bytes.Buffer{}
+		count, err := Export(source, archive, format, Filter{})
+		require.NoError(t, err, format)
+		assert.Equal(t, 3, count, format)
+
+		target := modelstest.Open(t, filepath.Join(dir, format+".db"))
+		result, err := Import(target, archive, format, Fail)
+		require.NoError(t, err, format)
+		assert.Equal(t, &Result{Created: 3}, result, format)
+
+		imported := []*models.Message{}
+		require.NoError(t, target.Unscoped().Order("created_at").Find(&imported).Error)
+		require.Len(t, imported, 3, format)
+
+		for i, message := range imported {
+			assert.Equal(t, messages[i].ID, message.ID, format)
+			assert.Equal(t, messages[i].Text, message.Text, format)
+			assert.True(t, messages[i].CreatedAt.Equal(message.CreatedAt), format)
+			assert.True(t, messages[i].UpdatedAt.Equal(message.UpdatedAt), format)
+			assert.Equal(t, messages[i].TemplateID, message.TemplateID, format)
+			assert.Equal(t, messages[i].ScheduleID, message.ScheduleID, format)
+		}
+		assert.Nil(t, imported[0].DeletedAt, format)
+		require.NotNil(t, imported[2].DeletedAt, format)
+		assert.True(t, messages[2].DeletedAt.Equal(*imported[2].DeletedAt), format)
+
+		target.Close()
+	}
+}
+
+func TestExportFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := modelstest.Open(t, filepath.Join(dir, "moc.db"))
+	defer db.Close()
+	messages := seed(t, db)
+
+	archive := &bytes.Buffer{}
+	_, err = Export(db, archive, CSV, Filter{
+		Since: messages[1].CreatedAt,
+		Until: messages[2].CreatedAt,
+	})
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(archive.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "id,message,created_at,updated_at,deleted_at,template_id,schedule_id", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], messages[1].ID+`,"Talk at 8pm, ""Go"""`))
+}
+
+func TestImportConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := modelstest.Open(t, filepath.Join(dir, "moc.db"))
+	defer db.Close()
+	messages := seed(t, db)
+
+	archive := &bytes.Buffer{}
+	_, err = Export(db, archive, JSONLines, Filter{})
+	require.NoError(t, err)
+
+	// a new message besides the changed ones, the first one was rendered by
+	// a template
+	data := strings.Replace(archive.String(), `"message":"Hackspace is open"`, `"message":"Hackspace opens at 6pm","template_id":"0f8fad5b-d9cb-469f-a165-70867728950e"`, 1) +
+		`{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","message":"Talk at 9pm","created_at":"2019-05-02T00:00:00Z","updated_at":"2019-05-02T00:00:00Z"}` + "\n"
+
+	// the conflicts fail the whole import
+	_, err = Import(db, strings.NewReader(data), JSONLines, Fail)
+	assert.EqualError(t, err, "entry 1: message "+messages[0].ID+" exists")
+
+	var count int
+	db.Unscoped().Model(&models.Message{}).Count(&count)
+	assert.Equal(t, 3, count)
+
+	result, err := Import(db, strings.NewReader(data), JSONLines, Skip)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Created: 1, Skipped: 3}, result)
+
+	message := &models.Message{}
+	require.NoError(t, db.First(message, "id = ?", messages[0].ID).Error)
+	assert.Equal(t, "Hackspace is open", message.Text)
+
+	result, err = Import(db, strings.NewReader(data), JSONLines, Overwrite)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Overwritten: 4}, result)
+
+	require.NoError(t, db.First(message, "id = ?", messages[0].ID).Error)
+	assert.Equal(t, "Hackspace opens at 6pm", message.Text)
+	require.NotNil(t, message.TemplateID)
+	assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", *message.TemplateID)
+
+	// deleted messages stay deleted
+	assert.True(t, db.First(&models.Message{}, "id = ?", messages[2].ID).RecordNotFound())
+}
+
+func TestImportBroken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := modelstest.Open(t, filepath.Join(dir, "moc.db"))
+	defer db.Close()
+
+	_, err = Import(db, strings.NewReader(`{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","message":"ab"}`), JSONLines, Fail)
+	assert.EqualError(t, err, "entry 1: invalid message map[message:min]")
+
+	_, err = Import(db, strings.NewReader(`{"id":"1","message":"Hackspace is open"}`), JSONLines, Fail)
+	assert.EqualError(t, err, "entry 1: bad id 1")
+
+	_, err = Import(db, strings.NewReader(`{"id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8","message":"Hackspace is open","schedule_id":"nightly"}`), JSONLines, Fail)
+	assert.EqualError(t, err, "entry 1: bad id nightly")
+
+	_, err = Import(db, strings.NewReader("id,message\n"), CSV, Fail)
+	assert.Error(t, err)
+
+	// archives of older versions have no template and schedule columns
+	result, err := Import(db, strings.NewReader("6ba7b810-9dad-11d1-80b4-00c04fd430c8,Hackspace is open,2019-05-01T00:00:00Z,2019-05-01T00:00:00Z,\n"), CSV, Fail)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Created: 1}, result)
+
+	_, err = Import(db, strings.NewReader(""), "xml", Fail)
+	assert.EqualError(t, err, "unknown format xml")
+}
@@ -0,0 +1,255 @@
+// Package backup snapshots a running sqlite database with the online backup
+// api and restores the snapshots.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// prefix and extension of the backup files in a directory
+const (
+	prefix    = "moc-"
+	extension = ".sqlite3"
+)
+
+// timeFormat of the backup names, sortable and without colons
+const timeFormat = "20060102T150405Z"
+
+// Name of a backup taken at a time like moc-20190501T200000Z.sqlite3
+func Name(t time.Time) string {
+	return prefix + t.UTC().Format(timeFormat) + extension
+}
+
+// Backup copies the database to path page by page. The copy is consistent
+// even while the database is written, it is renamed to path once complete.
+// Missing directories of path are created.
+func Backup(ctx context.Context, db *sql.DB, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "create backup dir")
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	if err := copyDatabase(ctx, db, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return errors.Wrap(os.Rename(tmp, path), "move backup")
+}
+
+// copyDatabase with the backup api of sqlite into a new file
+func copyDatabase(ctx context.Context, db *sql.DB, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return errors.Wrap(err, "open backup")
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "open backup")
+	}
+	defer destConn.Close()
+
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.Wrap(err, "open database")
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriver interface{}) error {
+		return srcConn.Raw(func(srcDriver interface{}) error {
+			srcSQLite, ok := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backups need a sqlite3 database")
+			}
+			destSQLite := destDriver.(*sqlite3.SQLiteConn)
+
+			b, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return errors.Wrap(err, "start backup")
+			}
+
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return errors.Wrap(err, "copy database")
+			}
+
+			return errors.Wrap(b.Finish(), "finish backup")
+		})
+	})
+}
+
+// Check opens a backup read only and fails if it is broken or misses tables
+// or columns of this version of moc
+func Check(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := gorm.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return errors.Wrap(err, "open backup")
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.DB().QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return errors.Wrap(err, "check backup")
+	}
+	if result != "ok" {
+		return fmt.Errorf("backup is corrupt: %s", result)
+	}
+
+	if pending := models.Pending(db); len(pending) > 0 {
+		return fmt.Errorf("backup misses %s, restore it with the moc version which took it and migrate", strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// Restore checks a backup and replaces the database at path, which may be a
+// uri like DATABASE_PATH, with a copy of it. It fails with ErrInUse while
+// another process uses the database. The replaced files are kept with the
+// suffix .before-restore and the time of the restore, the returned path.
+func Restore(ctx context.Context, backup string, path string) (string, error) {
+	if err := Check(backup); err != nil {
+		return "", err
+	}
+
+	path = File(path)
+	lock, err := lockFile(path, true)
+	if err == errLocked {
+		return "", ErrInUse
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "lock database")
+	}
+	defer lock.Release()
+
+	aside := path + ".before-restore-" + time.Now().UTC().Format(timeFormat)
+	suffixes := []string{"", "-wal", "-shm", "-journal"}
+	for _, suffix := range suffixes {
+		if _, err := os.Stat(aside + suffix); err == nil {
+			return "", fmt.Errorf("%s exists", aside+suffix)
+		}
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+backup+"?mode=ro")
+	if err != nil {
+		return "", errors.Wrap(err, "open backup")
+	}
+	defer src.Close()
+
+	// the copy sits next to the database, so the rename can't cross devices
+	tmp := path + ".restore"
+	if err := Backup(ctx, src, tmp); err != nil {
+		return "", err
+	}
+
+	for _, suffix := range suffixes {
+		err := os.Rename(path+suffix, aside+suffix)
+		if err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return "", errors.Wrap(err, "move database aside")
+		}
+	}
+
+	return aside, errors.Wrap(os.Rename(tmp, path), "move backup")
+}
+
+// Prune removes the oldest backups in dir until keep are left
+func Prune(dir string, keep int) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.Mode().IsRegular() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, extension) {
+			backups = append(backups, name)
+		}
+	}
+
+	// the names sort by time
+	sort.Strings(backups)
+
+	removed := []string{}
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backups[0])
+		backups = backups[1:]
+	}
+
+	return removed, nil
+}
+
+// Periodic backs the database up into dir every interval and keeps the
+// newest backups. The returned func stops it and waits for a running backup.
+func Periodic(db *sql.DB, dir string, interval time.Duration, keep int, logger *log.Entry) func(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				// a started backup is finished on stop
+				path := filepath.Join(dir, Name(now))
+				if err := Backup(context.Background(), db, path); err != nil {
+					logger.WithError(err).Error("backup failed")
+					continue
+				}
+				logger.WithField("file", path).Info("Backup done")
+
+				removed, err := Prune(dir, keep)
+				if err != nil {
+					logger.WithError(err).Error("backup cleanup failed")
+				}
+				for _, name := range removed {
+					logger.WithField("file", filepath.Join(dir, name)).Info("Backup removed")
+				}
+			}
+		}
+	}()
+
+	return func(stopCtx context.Context) error {
+		cancel()
+
+		select {
+		case <-done:
+			return nil
+		case <-stopCtx.Done():
+			return stopCtx.Err()
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/models/modelstest"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moc.db")
+	db := modelstest.Open(t, path)
+	require.NoError(t, db.Create(models.NewMessage("Hackspace is open")).Error)
+
+	// the backup is taken while the database is open
+	file := filepath.Join(dir, Name(time.Now()))
+	require.NoError(t, Backup(context.Background(), db.DB(), file))
+	require.NoError(t, Check(file))
+
+	require.NoError(t, db.Create(models.NewMessage("Hackspace is closed")).Error)
+
+	// serve holds the lock until it ends
+	lock, err := Use(path)
+	require.NoError(t, err)
+	_, err = Restore(context.Background(), file, path)
+	assert.Equal(t, ErrInUse, err)
+	require.NoError(t, lock.Release())
+	require.NoError(t, db.Close())
+
+	aside, err := Restore(context.Background(), file, path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(aside, path+".before-restore-"))
+	assert.FileExists(t, aside)
+
+	// a second restore in the same second does not overwrite the first copy
+	_, err = Restore(context.Background(), file, path)
+	if err != nil {
+		assert.Contains(t, err.Error(), "exists")
+	}
+	assert.FileExists(t, aside)
+
+	db, err = gorm.Open("sqlite3", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	messages := []*models.Message{}
+	require.NoError(t, db.Find(&messages).Error)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Hackspace is open", messages[0].Text)
+}
+
+func TestRestoreUnmigrated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moc.db")
+	modelstest.Open(t, path).Close()
+
+	file := filepath.Join(dir, "old.sqlite3")
+	old, err := gorm.Open("sqlite3", file)
+	require.NoError(t, err)
+	require.NoError(t, old.Exec("CREATE TABLE messages (id varchar(36) PRIMARY KEY, text varchar(255))").Error)
+	old.Close()
+
+	_, err = Restore(context.Background(), file, path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "messages.created_at")
+
+	_, err = Restore(context.Background(), filepath.Join(dir, "missing.sqlite3"), path)
+	assert.Error(t, err)
+
+	matches, err := filepath.Glob(path + ".before-restore*")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestUseDuringRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moc.db")
+
+	restore, err := lockFile(path, true)
+	require.NoError(t, err)
+
+	_, err = Use(path)
+	assert.Equal(t, ErrRestoring, err)
+	require.NoError(t, restore.Release())
+
+	// several processes use the database at once
+	first, err := Use(path)
+	require.NoError(t, err)
+	defer first.Release()
+	second, err := Use(path)
+	require.NoError(t, err)
+	defer second.Release()
+}
+
+func TestRestoreURI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moc.db")
+	uri := "file:" + path + "?_busy_timeout=5000"
+
+	db := modelstest.Open(t, uri)
+	require.NoError(t, db.Create(models.NewMessage("Hackspace is open")).Error)
+	file := filepath.Join(dir, Name(time.Now()))
+	require.NoError(t, Backup(context.Background(), db.DB(), file))
+
+	// the lock sits next to the file, not next to the uri
+	lock, err := Use(uri)
+	require.NoError(t, err)
+	assert.FileExists(t, path+".lock")
+
+	_, err = Restore(context.Background(), file, path)
+	assert.Equal(t, ErrInUse, err)
+	require.NoError(t, lock.Release())
+	require.NoError(t, db.Close())
+
+	aside, err := Restore(context.Background(), file, uri)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(aside, path+".before-restore-"))
+	assert.FileExists(t, path)
+}
+
+func TestFile(t *testing.T) {
+	for dsn, file := range map[string]string{
+		"/data/moc.db":                         "/data/moc.db",
+		"moc.db?_busy_timeout=5000":            "moc.db",
+		"file:/data/moc.db?_busy_timeout=5000": "/data/moc.db",
+		"file:///data/moc%20db":                "/data/moc db",
+		"file://localhost/data/moc.db":         "/data/moc.db",
+		":memory:":                             "",
+		"file::memory:?cache=shared":           "",
+		"file:moc.db?mode=memory&cache=shared": "",
+	} {
+		assert.Equal(t, file, File(dsn), dsn)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2019, 5, 1, 20, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, Name(start.Add(time.Duration(i)*time.Hour))), nil, 0600))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0600))
+
+	removed, err := Prune(dir, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"moc-20190501T200000Z.sqlite3", "moc-20190501T210000Z.sqlite3"}, removed)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"moc-20190501T220000Z.sqlite3", "moc-20190501T230000Z.sqlite3", "notes.txt"}, names)
+}
+
+func TestPeriodic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-backup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := modelstest.Open(t, filepath.Join(dir, "moc.db"))
+	defer db.Close()
+
+	// the backup dir is created by the first backup
+	backups := filepath.Join(dir, "data", "backups")
+
+	stop := Periodic(db.DB(), backups, 10*time.Millisecond, 1, log.NewEntry(log.StandardLogger()))
+	assert.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(backups, "moc-*.sqlite3"))
+		return len(files) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, stop(context.Background()))
+}
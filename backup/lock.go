@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errLocked by another process
+var errLocked = errors.New("locked")
+
+// ErrInUse of a database which another process has open
+var ErrInUse = errors.New("database is in use, stop serve, the relays and other commands first")
+
+// ErrRestoring of a database which is being restored
+var ErrRestoring = errors.New("database is being restored")
+
+// Lock of a sqlite database file, shared while moc uses the database and
+// exclusive during a restore
+type Lock struct {
+	file *os.File
+}
+
+// Use locks the database at path against restores until it is released or
+// the process ends, it fails with ErrRestoring during a restore
+func Use(path string) (*Lock, error) {
+	lock, err := lockFile(path, false)
+	if err == errLocked {
+		return nil, ErrRestoring
+	}
+
+	return lock, err
+}
+
+// File of a sqlite database. DATABASE_PATH may be a uri like
+// file:/data/moc.db?_busy_timeout=5000 or carry options after a ?, the file
+// is empty for in-memory databases.
+func File(path string) string {
+	query := ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+
+	if strings.HasPrefix(path, "file:") {
+		path = strings.TrimPrefix(path, "file:")
+		// file:///data/moc.db and file://localhost/data/moc.db
+		if strings.HasPrefix(path, "//") {
+			path = strings.TrimPrefix(strings.TrimPrefix(path, "//"), "localhost")
+		}
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+	}
+
+	if values, err := url.ParseQuery(query); err == nil && values.Get("mode") == "memory" {
+		return ""
+	}
+	if path == ":memory:" {
+		return ""
+	}
+
+	return path
+}
+
+// lockFile next to the database file without waiting
+func lockFile(path string, exclusive bool) (*Lock, error) {
+	path = File(path)
+	if path == "" {
+		return nil, errors.New("in-memory databases can't be locked")
+	}
+
+	file, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flock(file, exclusive); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Lock{file: file}, nil
+}
+
+// Release the lock
+func (l *Lock) Release() error {
+	return l.file.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package backup
+
+import (
+	"os"
+)
+
+// flock is not supported, restores are not kept from running databases
+func flock(file *os.File, exclusive bool) error {
+	return nil
+}
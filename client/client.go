@@ -0,0 +1,277 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// maxResponseSize of api responses
+const maxResponseSize = 10 << 20
+
+// Client talks to the moc api
+type Client struct {
+	BaseURL string
+	Token   string
+
+	// MaxRetries on server errors
+	MaxRetries int
+	// Backoff is the first delay between retries, it doubles every retry
+	Backoff time.Duration
+
+	HTTPClient *http.Client
+}
+
+// New client for a moc at baseURL like https://moc.example.com, the token
+// is the operator token and may be empty for public endpoints
+func New(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ListOptions filter and paginate messages
+type ListOptions struct {
+	// Since only lists messages created since
+	Since time.Time
+	// Page starts at 1
+	Page int
+	// PerPage defaults to all messages
+	PerPage int
+}
+
+// MessageList is a page of messages
+type MessageList struct {
+	Messages []*models.Message
+	// Total of all pages
+	Total int
+	// NextPage is 0 on the last page
+	NextPage int
+}
+
+// ListMessages returns a page of messages
+func (c *Client) ListMessages(ctx context.Context, opts *ListOptions) (*MessageList, error) {
+	query := url.Values{}
+	if opts != nil {
+		if !opts.Since.IsZero() {
+			query.Set("since", opts.Since.Format(time.RFC3339Nano))
+		}
+		if opts.Page > 0 {
+			query.Set("page", strconv.Itoa(opts.Page))
+		}
+		if opts.PerPage > 0 {
+			query.Set("per_page", strconv.Itoa(opts.PerPage))
+		}
+	}
+
+	path := "/messages"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	list := &MessageList{}
+	res, err := c.do(ctx, http.MethodGet, path, nil, &list.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	list.Total, _ = strconv.Atoi(res.Header.Get("X-Total-Count"))
+	list.NextPage = nextPage(res.Header.Get("Link"))
+
+	return list, nil
+}
+
+// AllMessages follows all pages of a list
+func (c *Client) AllMessages(ctx context.Context, opts *ListOptions) ([]*models.Message, error) {
+	page := ListOptions{PerPage: 100}
+	if opts != nil {
+		page = *opts
+	}
+	if page.Page < 1 {
+		page.Page = 1
+	}
+
+	messages := []*models.Message{}
+	for {
+		list, err := c.ListMessages(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, list.Messages...)
+		if list.NextPage == 0 {
+			return messages, nil
+		}
+		page.Page = list.NextPage
+	}
+}
+
+// CreateMessage posts a new message
+func (c *Client) CreateMessage(ctx context.Context, text string) (*models.Message, error) {
+	message := &models.Message{}
+	if _, err := c.do(ctx, http.MethodPost, "/messages", models.MessageRequest{Text: text}, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// GetMessage by id
+func (c *Client) GetMessage(ctx context.Context, id string) (*models.Message, error) {
+	message := &models.Message{}
+	if _, err := c.do(ctx, http.MethodGet, "/messages/"+url.PathEscape(id), nil, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// DeleteMessage by id and return the deleted message
+func (c *Client) DeleteMessage(ctx context.Context, id string) (*models.Message, error) {
+	message := &models.Message{}
+	if _, err := c.do(ctx, http.MethodDelete, "/messages/"+url.PathEscape(id), nil, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// IsNotFound checks if the api responded with 404
+func IsNotFound(err error) bool {
+	httpErr, ok := err.(*router.HTTPError)
+	return ok && httpErr.Code == http.StatusNotFound
+}
+
+// do a request and retry on server errors. Requests which are not idempotent
+// are retried only if they were never sent, a proxy may answer 502 or 504
+// after the server handled them.
+func (c *Client) do(ctx context.Context, method string, path string, request interface{}, response interface{}) (*http.Response, error) {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return nil, err
+		}
+	}
+
+	delay := c.Backoff
+	for attempt := 0; ; attempt++ {
+		res, err := c.request(ctx, method, path, body, response)
+
+		if err == nil || attempt >= c.MaxRetries || !retry(method, err) {
+			return res, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// retry a failed request
+func retry(method string, err error) bool {
+	// no connection, so nothing was sent
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	httpErr, ok := err.(*router.HTTPError)
+	return ok && httpErr.Code >= http.StatusInternalServerError && method != http.MethodPost
+}
+
+// request sends a single request and decodes the response or the error
+func (c *Client) request(ctx context.Context, method string, path string, body []byte, response interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return res, decodeError(res.StatusCode, data)
+	}
+
+	if response == nil {
+		return res, nil
+	}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return res, fmt.Errorf("bad response: %v", err)
+	}
+
+	return res, nil
+}
+
+// decodeError turns an error response into a router.HTTPError, responses of
+// proxies without json body keep the status
+func decodeError(status int, data []byte) error {
+	httpErr := &router.HTTPError{}
+	if err := json.Unmarshal(data, httpErr); err != nil || httpErr.Code == 0 {
+		return &router.HTTPError{
+			Object:  "error",
+			Code:    status,
+			Message: http.StatusText(status),
+		}
+	}
+
+	return httpErr
+}
+
+var nextLink = regexp.MustCompile(`<[^>]*[?&]page=(\d+)[^>]*>;\s*rel="next"`)
+
+// nextPage from a link header
+func nextPage(link string) int {
+	match := nextLink.FindStringSubmatch(link)
+	if match == nil {
+		return 0
+	}
+
+	page, _ := strconv.Atoi(match[1])
+	return page
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/api"
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/router"
+)
+
+// flaky fails the first requests with an error status
+type flaky struct {
+	handler  http.Handler
+	failures int32
+	status   int
+	requests int32
+	// handled fails after the request was handled, like a proxy timeout
+	handled bool
+}
+
+func (f *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.requests, 1)
+
+	if atomic.AddInt32(&f.failures, -1) >= 0 {
+		if f.handled {
+			f.handler.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		w.WriteHeader(f.status)
+		return
+	}
+
+	f.handler.ServeHTTP(w, r)
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *flaky, func()) {
+	dir, err := ioutil.TempDir("", "moc-client")
+	require.NoError(t, err)
+
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	db.AutoMigrate(models.All()...)
+
+	logrus.SetLevel(logrus.ErrorLevel)
+
+	handler := &flaky{handler: api.NewAPI(db, &config.Config{OperatorToken: "secret"}).Handler()}
+	server := httptest.NewServer(handler)
+
+	return server, handler, func() {
+		server.Close()
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	server, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := New(server.URL, "secret")
+
+	created := []*models.Message{}
+	for _, text := range []string{"first", "second", "third"} {
+		message, err := client.CreateMessage(ctx, text)
+		require.NoError(t, err)
+		assert.Equal(t, text, message.Text)
+		assert.NotEmpty(t, message.ID)
+
+		created = append(created, message)
+		time.Sleep(time.Millisecond)
+	}
+
+	message, err := client.GetMessage(ctx, created[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "first", message.Text)
+
+	list, err := client.ListMessages(ctx, &ListOptions{Page: 1, PerPage: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, 2, list.NextPage)
+	assert.Len(t, list.Messages, 2)
+
+	list, err = client.ListMessages(ctx, &ListOptions{Since: created[1].CreatedAt})
+	require.NoError(t, err)
+	assert.Equal(t, 2, list.Total)
+	assert.Equal(t, 0, list.NextPage)
+
+	all, err := client.AllMessages(ctx, &ListOptions{PerPage: 1})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	deleted, err := client.DeleteMessage(ctx, created[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, created[0].ID, deleted.ID)
+
+	_, err = client.GetMessage(ctx, created[0].ID)
+	assert.True(t, IsNotFound(err))
+
+	_, err = client.CreateMessage(ctx, "ab")
+	require.IsType(t, &router.HTTPError{}, err)
+	httpErr := err.(*router.HTTPError)
+	assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+	assert.Equal(t, "bad payload", httpErr.Message)
+	assert.Equal(t, map[string]interface{}{"message": "min"}, httpErr.Json)
+}
+
+func TestRetries(t *testing.T) {
+	server, handler, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	client := New(server.URL, "secret")
+	client.Backoff = time.Millisecond
+
+	// server errors are retried
+	handler.failures, handler.status = 2, http.StatusInternalServerError
+	_, err := client.ListMessages(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), handler.requests)
+
+	// new messages are not posted twice
+	handler.failures, handler.status, handler.requests = 1, http.StatusInternalServerError, 0
+	_, err = client.CreateMessage(ctx, "Hackspace is open")
+	assert.EqualError(t, err, "500: Internal Server Error")
+	assert.Equal(t, int32(1), handler.requests)
+
+	// not even on a gateway timeout after the insert
+	handler.failures, handler.status, handler.requests, handler.handled = 1, http.StatusGatewayTimeout, 0, true
+	_, err = client.CreateMessage(ctx, "Hackspace is closed")
+	assert.EqualError(t, err, "504: Gateway Timeout")
+	assert.Equal(t, int32(1), handler.requests)
+	handler.handled = false
+
+	list, err := client.ListMessages(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, list.Total)
+
+	// unless the request was never sent
+	var dials int32
+	client.HTTPClient = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}}
+	handler.requests = 0
+	_, err = client.CreateMessage(ctx, "Hackspace is open")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), dials)
+	assert.Equal(t, int32(1), handler.requests)
+
+	// give up after max retries
+	handler.failures, handler.status, handler.requests = 10, http.StatusServiceUnavailable, 0
+	_, err = client.ListMessages(ctx, nil)
+	assert.Error(t, err)
+	assert.Equal(t, int32(client.MaxRetries+1), handler.requests)
+}
+
+func TestSubscribe(t *testing.T) {
+	server, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := New(server.URL, "secret")
+	client.Backoff = time.Millisecond
+
+	events := make(chan *Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- client.Subscribe(ctx, func(event *Event) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	// the stream may not be connected yet, so post until an event arrives
+	var event *Event
+	for i := 0; i < 50 && event == nil; i++ {
+		_, err := client.CreateMessage(ctx, "Hackspace is open")
+		require.NoError(t, err)
+
+		select {
+		case event = <-events:
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	require.NotNil(t, event)
+	assert.Equal(t, EventCreated, event.Type)
+	assert.Equal(t, "Hackspace is open", event.Message.Text)
+
+	deleted, err := client.DeleteMessage(ctx, event.Message.ID)
+	require.NoError(t, err)
+
+	for event = range events {
+		if event.Type == EventDeleted {
+			break
+		}
+	}
+	assert.Equal(t, deleted.ID, event.Message.ID)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// Event types of the live stream
+const (
+	EventCreated = "created"
+	EventDeleted = "deleted"
+)
+
+// Event is a message change of the live stream
+type Event struct {
+	Type    string
+	Message *models.Message
+}
+
+// errStop ends the stream without reconnecting
+type errStop struct {
+	err error
+}
+
+func (e errStop) Error() string {
+	return e.err.Error()
+}
+
+// Subscribe to the live stream and call fn for every event until the
+// context is canceled or fn returns an error. Lost connections are
+// reconnected, events sent in between are missed.
+func (c *Client) Subscribe(ctx context.Context, fn func(*Event) error) error {
+	delay := c.Backoff
+
+	for {
+		connected, err := c.stream(ctx, fn)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if stop, ok := err.(errStop); ok {
+			return stop.err
+		}
+
+		if connected {
+			delay = c.Backoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > time.Minute {
+			delay = time.Minute
+		}
+	}
+}
+
+// stream reads a single connection and reports if it was established
+func (c *Client) stream(ctx context.Context, fn func(*Event) error) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/messages/stream", nil)
+	if err != nil {
+		return false, errStop{err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+
+	// the timeout of the client would end the stream
+	client := *c.HTTPClient
+	client.Timeout = 0
+
+	res, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(res.Body)
+		err := decodeError(res.StatusCode, data)
+		if res.StatusCode < http.StatusInternalServerError {
+			return false, errStop{err}
+		}
+		return false, err
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseSize)
+
+	event := &Event{}
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if event.Message != nil {
+				if err := fn(event); err != nil {
+					return true, errStop{err}
+				}
+			}
+			event = &Event{}
+		case strings.HasPrefix(line, "event:"):
+			event.Type = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			message := &models.Message{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), message); err != nil {
+				return true, err
+			}
+			event.Message = message
+		}
+	}
+
+	return true, scanner.Err()
+}
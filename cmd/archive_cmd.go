@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/chaostreff-flensburg/moc/archive"
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+var archiveFormat = ""
+var exportOutput = ""
+var exportSince = ""
+var exportUntil = ""
+var importConflict = archive.Fail
+
+var exportCmd = cobra.Command{
+	Use:   "export",
+	Short: "Export all messages to a file",
+	Long:  "Export all messages with the deleted ones as json lines or csv straight from the database, ids and timestamps are kept for an import in another moc.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, exportMessages)
+	},
+}
+
+var importCmd = cobra.Command{
+	Use:   "import [file]",
+	Short: "Import messages of an export",
+	Long:  "Import an export of json lines or csv from a file or stdin straight into the database. Nothing is imported if a message is broken or an id exists with --conflict fail.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, func(config *config.Config) {
+			file := "-"
+			if len(args) > 0 {
+				file = args[0]
+			}
+			importMessages(config, file)
+		})
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&archiveFormat, "format", "", "jsonl or csv (default by the file extension or jsonl)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "-", "file, - for stdout")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "only messages created since a duration like 24h or a time like 2019-05-01T20:00:00Z")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "only messages created before a duration like 24h or a time like 2019-05-01T20:00:00Z")
+
+	importCmd.Flags().StringVar(&archiveFormat, "format", "", "jsonl or csv (default by the file extension or jsonl)")
+	importCmd.Flags().StringVar(&importConflict, "conflict", archive.Fail, "skip, overwrite or fail on existing ids")
+}
+
+// exportMessages of the database to the output file
+func exportMessages(config *config.Config) {
+	format := fileFormat(exportOutput)
+
+	filter := archive.Filter{}
+	var err error
+	if filter.Since, err = parseTimeFlag("since", exportSince); err != nil {
+		log.Fatal(err)
+	}
+	if filter.Until, err = parseTimeFlag("until", exportUntil); err != nil {
+		log.Fatal(err)
+	}
+
+	db := openDatabase(signalContext(), config)
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if exportOutput != "-" {
+		file, err := os.Create(exportOutput)
+		if err != nil {
+			log.WithError(err).Fatal("export failed")
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count, err := archive.Export(db, w, format, filter)
+	if err != nil {
+		log.WithError(err).Fatal("export failed")
+	}
+	log.Infof("Exported %d messages", count)
+}
+
+// importMessages of a file or stdin into the database
+func importMessages(config *config.Config, file string) {
+	format := fileFormat(file)
+	if !archive.ValidMode(importConflict) {
+		log.Fatalf("bad conflict %q, use skip, overwrite or fail", importConflict)
+	}
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			log.WithError(err).Fatal("import failed")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db := openDatabase(signalContext(), config)
+	defer db.Close()
+
+	result, err := archive.Import(db, r, format, importConflict)
+	if err != nil {
+		log.WithError(err).Fatal("import failed")
+	}
+	log.Infof("Imported %d messages, overwritten %d, skipped %d", result.Created, result.Overwritten, result.Skipped)
+}
+
+// fileFormat of the format flag or the extension of a file
+func fileFormat(file string) string {
+	format := archiveFormat
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+		if !archive.ValidFormat(format) {
+			format = archive.JSONLines
+		}
+	}
+
+	if !archive.ValidFormat(format) {
+		log.Fatalf("bad format %q, use jsonl or csv", format)
+	}
+
+	return format
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/chaostreff-flensburg/moc/backup"
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+var backupCmd = cobra.Command{
+	Use:   "backup [file]",
+	Short: "Back up the sqlite database",
+	Long:  "Take a consistent snapshot of the sqlite database, safe while serve is running. Without a file the backup is written to BACKUP_DIR or the current directory, the oldest backups beyond BACKUP_KEEP are removed there.",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, func(config *config.Config) {
+			file := ""
+			if len(args) > 0 {
+				file = args[0]
+			}
+			backupDatabase(config, file)
+		})
+	},
+}
+
+var restoreCmd = cobra.Command{
+	Use:   "restore <file>",
+	Short: "Restore the sqlite database of a backup",
+	Long:  "Check a backup and replace the sqlite database with it. It refuses while serve or another command uses the database, the replaced database is kept with the suffix .before-restore and the time of the restore.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, func(config *config.Config) {
+			restoreDatabase(config, args[0])
+		})
+	},
+}
+
+// backupDatabase into a file or the backup directory
+func backupDatabase(config *config.Config, file string) {
+	if config.Database.Driver != "sqlite3" {
+		log.Fatal("backups need the driver sqlite3, use the tools of your database")
+	}
+
+	dir := config.Backup.Dir
+	if file == "" {
+		if dir == "" {
+			dir = "."
+		}
+		file = filepath.Join(dir, backup.Name(time.Now()))
+	}
+
+	ctx := signalContext()
+	db := openDatabase(ctx, config)
+	defer db.Close()
+
+	if err := backup.Backup(ctx, db.DB(), file); err != nil {
+		log.WithError(err).Fatal("backup failed")
+	}
+	log.WithField("file", file).Info("Backup done")
+
+	// only the backup directory is cleaned up
+	if len(config.Backup.Dir) > 0 && filepath.Dir(file) == filepath.Clean(config.Backup.Dir) {
+		removed, err := backup.Prune(config.Backup.Dir, config.Backup.Keep)
+		if err != nil {
+			log.WithError(err).Error("backup cleanup failed")
+		}
+		for _, name := range removed {
+			log.WithField("file", filepath.Join(config.Backup.Dir, name)).Info("Backup removed")
+		}
+	}
+}
+
+// restoreDatabase of a backup file
+func restoreDatabase(config *config.Config, file string) {
+	if config.Database.Driver != "sqlite3" {
+		log.Fatal("backups need the driver sqlite3, use the tools of your database")
+	}
+
+	aside, err := backup.Restore(signalContext(), file, config.Database.Path)
+	if err != nil {
+		log.WithError(err).Fatal("restore failed")
+	}
+	log.WithField("file", file).WithField("replaced", aside).Info("Restored")
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+var configCmd = cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configPrintCmd = cobra.Command{
+	Use:           "print",
+	Short:         "Print the effective configuration",
+	Long:          "Print the configuration merged from defaults, config file, env vars and flags as yaml. Secrets are redacted.",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := config.Load(configFile, cmd.Flags())
+		if c == nil {
+			return err
+		}
+
+		if printErr := c.Print(cmd.OutOrStdout()); printErr != nil {
+			return printErr
+		}
+
+		return err
+	},
+}
+
+func init() {
+	configCmd.AddCommand(&configPrintCmd)
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+var healthcheckURL = ""
+
+var healthcheckCmd = cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check if the server is ready",
+	Long:  "Check the readiness of the local server and exit with 1 if it is not ready. The image has no curl, so this is its docker HEALTHCHECK.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, healthcheck)
+	},
+}
+
+func init() {
+	healthcheckCmd.Flags().StringVar(&healthcheckURL, "url", "", "url of the readiness probe (default the first LISTEN address)")
+}
+
+// healthcheck asks the readiness probe of the server
+func healthcheck(config *config.Config) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	url := healthcheckURL
+	if url == "" {
+		url = probeURL(config, client)
+	}
+
+	res, err := client.Get(url)
+	if err != nil {
+		log.WithError(err).Fatal("not ready")
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Fatalf("not ready: %s", res.Status)
+	}
+
+	log.Info("ready")
+}
+
+// probeURL of the readiness probe on the first address the server listens
+// on, the client is set up to reach unix sockets and local tls
+func probeURL(config *config.Config, client *http.Client) string {
+	scheme := "http"
+	transport := &http.Transport{}
+
+	if config.Server.TLSCert != "" {
+		// the certificate is issued for the public name, not for localhost
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	address := config.Addresses()[0]
+	host := address
+
+	if strings.HasPrefix(address, "unix:") {
+		socket := strings.TrimPrefix(address, "unix:")
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		}
+		host = "localhost"
+	} else if hostname, port, err := net.SplitHostPort(address); err == nil {
+		switch hostname {
+		case "", "0.0.0.0", "::":
+			hostname = "localhost"
+		}
+		host = net.JoinHostPort(hostname, port)
+	}
+
+	client.Transport = transport
+
+	return scheme + "://" + host + "/readyz"
+}
@@ -3,11 +3,6 @@ package cmd
 import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"time"
-
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 
 	"github.com/chaostreff-flensburg/moc/config"
 	"github.com/chaostreff-flensburg/moc/models"
@@ -24,29 +19,13 @@ var migrateCmd = cobra.Command{
 
 // migrate database
 func migrate(config *config.Config) {
-	// ======================================
-	// Database
-	// ======================================
-	log.Info("Init Database...")
-
-	var db *gorm.DB
-	var err error
-	for {
-		db, err = gorm.Open(config.Database.Driver, config.Database.Path)
-		if err != nil {
-			log.Error("try to connect...")
-		} else {
-			break
-		}
-		time.Sleep(5 * time.Second)
-	}
+	db := openDatabase(signalContext(), config)
 	defer db.Close()
-	log.Info("Database connected!")
 
 	// ======================================
 	// Migrate
 	// ======================================
 	log.Info("Migrate...")
-	db.AutoMigrate(&models.Message{})
+	db.AutoMigrate(models.All()...)
 	log.Info("Finish...")
 }
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/chaostreff-flensburg/moc/client"
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+var msgURL string
+var msgToken string
+var msgSince string
+
+var msgCmd = cobra.Command{
+	Use:   "msg",
+	Short: "Manage messages of a running moc",
+	Long:  "Send, list, delete and follow messages of a running moc over http. The url and the operator token are read from MOC_URL and MOC_TOKEN or the flags.",
+}
+
+var msgSendCmd = cobra.Command{
+	Use:           "send <text>",
+	Short:         "Send a new message",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		message, err := msgClient().CreateMessage(context.Background(), strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), message.ID)
+		return nil
+	},
+}
+
+var msgListCmd = cobra.Command{
+	Use:           "list",
+	Short:         "List messages",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseSince(msgSince)
+		if err != nil {
+			return err
+		}
+
+		messages, err := msgClient().AllMessages(context.Background(), &client.ListOptions{Since: since, PerPage: 100})
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CREATED\tID\tMESSAGE")
+		for _, message := range messages {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", message.CreatedAt.Local().Format("2006-01-02 15:04"), message.ID, message.Text)
+		}
+
+		return w.Flush()
+	},
+}
+
+var msgRmCmd = cobra.Command{
+	Use:           "rm <id>...",
+	Short:         "Delete messages",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := msgClient()
+
+		for _, id := range args {
+			if _, err := c.DeleteMessage(context.Background(), id); err != nil {
+				return fmt.Errorf("delete %s: %v", id, err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+
+		return nil
+	},
+}
+
+var msgTailCmd = cobra.Command{
+	Use:           "tail",
+	Short:         "Follow created and deleted messages",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := parseSince(msgSince)
+		if err != nil {
+			return err
+		}
+
+		c := msgClient()
+		ctx := signalContext()
+		out := cmd.OutOrStdout()
+
+		if !since.IsZero() {
+			messages, err := c.AllMessages(ctx, &client.ListOptions{Since: since, PerPage: 100})
+			if err != nil {
+				return err
+			}
+
+			for _, message := range messages {
+				printEvent(out, client.EventCreated, message)
+			}
+		}
+
+		return c.Subscribe(ctx, func(event *client.Event) error {
+			printEvent(out, event.Type, event.Message)
+			return nil
+		})
+	},
+}
+
+func init() {
+	msgCmd.PersistentFlags().StringVar(&msgURL, "url", "", "url of moc (default $MOC_URL or http://localhost)")
+	msgCmd.PersistentFlags().StringVar(&msgToken, "token", "", "operator token (default $MOC_TOKEN)")
+
+	msgListCmd.Flags().StringVar(&msgSince, "since", "", "only messages since a duration like 1h or a time like 2019-05-01T20:00:00Z")
+	msgTailCmd.Flags().StringVar(&msgSince, "since", "", "print messages since a duration like 1h or a time like 2019-05-01T20:00:00Z first")
+
+	msgCmd.AddCommand(&msgSendCmd)
+	msgCmd.AddCommand(&msgListCmd)
+	msgCmd.AddCommand(&msgRmCmd)
+	msgCmd.AddCommand(&msgTailCmd)
+}
+
+// msgClient for the configured moc
+func msgClient() *client.Client {
+	url := msgURL
+	if url == "" {
+		url = os.Getenv("MOC_URL")
+	}
+	if url == "" {
+		url = "http://localhost"
+	}
+
+	token := msgToken
+	if token == "" {
+		token = os.Getenv("MOC_TOKEN")
+	}
+
+	return client.New(url, token)
+}
+
+// parseSince accepts a duration back from now or a time
+func parseSince(value string) (time.Time, error) {
+	return parseTimeFlag("since", value)
+}
+
+// parseTimeFlag accepts a duration back from now or a time
+func parseTimeFlag(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad %s %q, use a duration like 1h or a time like 2019-05-01T20:00:00Z", name, value)
+	}
+
+	return t, nil
+}
+
+// printEvent as a single line
+func printEvent(w io.Writer, eventType string, message *models.Message) {
+	fmt.Fprintf(w, "%s  %-7s  %s  %s\n", message.CreatedAt.Local().Format("15:04:05"), eventType, message.ID, message.Text)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+	_ "github.com/chaostreff-flensburg/moc/relay/irc"
+	_ "github.com/chaostreff-flensburg/moc/relay/mail"
+	_ "github.com/chaostreff-flensburg/moc/relay/matrix"
+	_ "github.com/chaostreff-flensburg/moc/relay/telegram"
+)
+
+var relayCmd = cobra.Command{
+	Use:   "relay",
+	Short: "Relay messages to other services",
+	Long:  "Relay new messages to other services like irc. The relay shares the database with the server.",
+}
+
+var relayIRCCmd = cobra.Command{
+	Use:   "irc",
+	Short: "Relay messages to irc channels",
+	Long:  "Connect to an irc server and post every new message to the configured channels.",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, runRelay("irc"))
+	},
+}
+
+var relayMailCmd = cobra.Command{
+	Use:   "mail",
+	Short: "Relay messages to e-mail subscribers",
+	Long:  "Send every new message to all confirmed subscribers over smtp. New subscribers get a confirmation link.",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, runRelay("mail"))
+	},
+}
+
+var relayMatrixCmd = cobra.Command{
+	Use:   "matrix",
+	Short: "Relay messages to matrix rooms",
+	Long:  "Post every new message as notice to the configured matrix rooms and redact it when the message is deleted.",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, runRelay("matrix"))
+	},
+}
+
+var relayTelegramCmd = cobra.Command{
+	Use:   "telegram",
+	Short: "Relay messages to telegram chats",
+	Long:  "Post every new message with a bot to the configured telegram chats and delete it when the message is deleted.",
+	Run: func(cmd *cobra.Command, args []string) {
+		execWithConfig(cmd, runRelay("telegram"))
+	},
+}
+
+func init() {
+	relayCmd.AddCommand(&relayIRCCmd)
+	relayCmd.AddCommand(&relayMailCmd)
+	relayCmd.AddCommand(&relayMatrixCmd)
+	relayCmd.AddCommand(&relayTelegramCmd)
+}
+
+// runRelay runs a single relay as its own process
+func runRelay(name string) func(config *config.Config) {
+	return func(config *config.Config) {
+		ctx := signalContext()
+
+		db := relayDatabase(ctx, config)
+		defer db.Close()
+
+		poller, err := relay.Open(ctx, name, config, db)
+		if err != nil {
+			log.WithError(err).Fatal("relay setup failed")
+		}
+
+		if err := poller.Run(ctx); err != nil {
+			log.WithError(err).Fatal("relay failed")
+		}
+	}
+}
+
+// relayDatabase connects to the database shared with the server
+func relayDatabase(ctx context.Context, config *config.Config) *gorm.DB {
+	db := openDatabase(ctx, config)
+	db.AutoMigrate(&models.Delivery{}, &models.Subscriber{})
+
+	return db
+}
+
+// signalContext is canceled on SIGINT or SIGTERM
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		sig := <-c
+		log.Infof("Stop from signal %s", sig)
+		cancel()
+	}()
+
+	return ctx
+}
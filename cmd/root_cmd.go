@@ -1,19 +1,32 @@
 package cmd
 
 import (
+	"context"
+
+	"github.com/chaostreff-flensburg/moc/backup"
 	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/database"
+	"github.com/chaostreff-flensburg/moc/logging"
+	"github.com/chaostreff-flensburg/moc/version"
 
+	"github.com/jinzhu/gorm"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var executeMigrate = false
 var executeSeed = false
+var configFile = ""
+
+// databaseLock keeps restores away from the sqlite database until the
+// process ends
+var databaseLock *backup.Lock
 
 // rootCmd will run the log streamer
 var rootCmd = cobra.Command{
-	Use:  "moc",
-	Long: "A service that will serve a restufl massage operation center",
+	Use:     "moc",
+	Long:    "A service that will serve a restufl massage operation center",
+	Version: version.Version,
 	Run: func(cmd *cobra.Command, args []string) {
 		execWithConfig(cmd, serve)
 	},
@@ -23,14 +36,53 @@ var rootCmd = cobra.Command{
 func RootCmd() *cobra.Command {
 	rootCmd.PersistentFlags().BoolVarP(&executeMigrate, "migrate", "m", false, "migrate database")
 	rootCmd.PersistentFlags().BoolVarP(&executeSeed, "seed", "s", false, "seed database")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "yaml config file (default $MOC_CONFIG)")
+	config.Flags(rootCmd.PersistentFlags())
 	rootCmd.AddCommand(&serveCmd)
+	rootCmd.AddCommand(&relayCmd)
+	rootCmd.AddCommand(&msgCmd)
+	rootCmd.AddCommand(&configCmd)
+	rootCmd.AddCommand(&healthcheckCmd)
+	rootCmd.AddCommand(&exportCmd)
+	rootCmd.AddCommand(&importCmd)
+	rootCmd.AddCommand(&backupCmd)
+	rootCmd.AddCommand(&restoreCmd)
 	return &rootCmd
 }
 
-// execWithConfig load config from env
+// execWithConfig load config from file, env and flags
 func execWithConfig(cmd *cobra.Command, fn func(config *config.Config)) {
 	logrus.Info("Read Config...")
-	config := config.ReadConfig()
+	c, err := config.Load(configFile, cmd.Flags())
+	if err != nil {
+		config.Fatal(err)
+	}
+
+	if err := logging.Configure(c); err != nil {
+		logrus.WithError(err).Fatal("log setup failed")
+	}
+
+	fn(c)
+}
+
+// openDatabase connects to the configured database or exits, it gives up
+// early once the context ends
+func openDatabase(ctx context.Context, config *config.Config) *gorm.DB {
+	logrus.Info("Init Database...")
+
+	if config.Database.Driver == "sqlite3" && backup.File(config.Database.Path) != "" {
+		lock, err := backup.Use(config.Database.Path)
+		if err != nil {
+			logrus.WithError(err).Fatal("database lock failed")
+		}
+		databaseLock = lock
+	}
+
+	db, err := database.Open(ctx, config)
+	if err != nil {
+		logrus.WithError(err).Fatal("database connection failed")
+	}
+	logrus.Info("Database connected!")
 
-	fn(config)
+	return db
 }
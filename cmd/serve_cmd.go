@@ -1,18 +1,22 @@
 package cmd
 
 import (
+	"context"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"time"
 
 	"github.com/sas1024/gorm-loggable"
 
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
-
 	"github.com/chaostreff-flensburg/moc/api"
+	"github.com/chaostreff-flensburg/moc/backup"
 	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/lifecycle"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/schedule"
+	"github.com/chaostreff-flensburg/moc/tracing"
 )
 
 var serveCmd = cobra.Command{
@@ -26,52 +30,141 @@ var serveCmd = cobra.Command{
 
 // serve server
 func serve(config *config.Config) {
-	log.SetFormatter(&log.TextFormatter{
-		DisableColors: false,
-		FullTimestamp: true,
-	})
+	ctx := signalContext()
+
+	// ======================================
+	// Tracing
+	// ======================================
+	stopTracing, err := tracing.Setup(ctx, config)
+	if err != nil {
+		log.WithError(err).Fatal("tracing setup failed")
+	}
+
+	// ======================================
+	// Database
+	// ======================================
+	db := openDatabase(ctx, config)
+	tracing.Instrument(db)
 
 	if executeMigrate {
 		log.Info("Migrate...")
-		migrate(config)
+		db.AutoMigrate(models.All()...)
 	}
 
 	if executeSeed {
 		log.Info("Seed...")
-		seed(config)
+		models.Seed(db)
 	}
 
 	// ======================================
-	// Database
+	// Log
+	// ======================================
+	_, err = loggable.Register(db)
+	if err != nil {
+		log.Error(err)
+	}
+
+	// ======================================
+	// Server
+	// ======================================
+	server := api.NewAPI(db, config)
+
+	// ======================================
+	// Relays
 	// ======================================
-	log.Info("Init Database...")
+	// relays outlive the signal to flush their queues
+	relayCtx, stopRelays := context.WithCancel(context.Background())
+	defer stopRelays()
 
-	var db *gorm.DB
-	var err error
-	for {
-		db, err = gorm.Open(config.Database.Driver, config.Database.Path)
+	var dispatcher *relay.Dispatcher
+	if len(config.Relays()) > 0 {
+		dispatcher, err = relay.NewDispatcher(relayCtx, config, db)
 		if err != nil {
-			log.Error("try to connect...")
-		} else {
-			break
+			log.WithError(err).Fatal("relay setup failed")
 		}
-		time.Sleep(5 * time.Second)
+		go dispatcher.Run(relayCtx)
+
+		server.SetDispatcher(dispatcher)
 	}
-	defer db.Close()
-	log.Info("Database connected!")
 
 	// ======================================
-	// Log
+	// Scheduler
 	// ======================================
-	_, err = loggable.Register(db)
-	if err != nil {
-		log.Error(err)
+	stopScheduler := func(ctx context.Context) error { return nil }
+	if config.Scheduler.Interval > 0 {
+		scheduler := schedule.NewScheduler(db)
+		scheduler.Interval = time.Duration(config.Scheduler.Interval) * time.Second
+		scheduler.Grace = time.Duration(config.Scheduler.Grace) * time.Second
+		scheduler.OnCreate = server.Created
+		go scheduler.Run(context.Background())
+
+		stopScheduler = scheduler.Shutdown
 	}
 
 	// ======================================
-	// Server
+	// Backups
 	// ======================================
-	server := api.NewAPI(db, config)
+	stopBackups := func(ctx context.Context) error { return nil }
+	if config.Backup.Interval > 0 {
+		stopBackups = backup.Periodic(db.DB(), config.Backup.Dir, time.Duration(config.Backup.Interval)*time.Minute,
+			config.Backup.Keep, log.WithField("component", "backup"))
+	}
+
+	// ======================================
+	// Lifecycle
+	// ======================================
+	manager := shutdown{
+		server:    server.Shutdown,
+		scheduler: stopScheduler,
+		jobs:      server.Drain,
+		relays: func(ctx context.Context) error {
+			defer stopRelays()
+			return dispatcher.Shutdown(ctx)
+		},
+		backups: stopBackups,
+		database: func(ctx context.Context) error {
+			return db.Close()
+		},
+		tracing: stopTracing,
+	}.manager(log.WithField("component", "lifecycle"), time.Duration(config.Server.ShutdownTimeout)*time.Second)
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			log.WithError(err).Fatal("http server failed")
+		}
+	}()
+
+	if err := manager.Wait(ctx); err != nil {
+		log.WithError(err).Fatal("unclean shutdown")
+	}
+	log.Info("Stopped")
+}
+
+// shutdown of the parts of serve
+type shutdown struct {
+	server    lifecycle.StopFunc
+	scheduler lifecycle.StopFunc
+	jobs      lifecycle.StopFunc
+	relays    lifecycle.StopFunc
+	backups   lifecycle.StopFunc
+	database  lifecycle.StopFunc
+	tracing   lifecycle.StopFunc
+}
+
+// manager which stops the parts in order: no new requests or scheduled
+// messages, then the work already started, the database once nothing uses
+// it anymore and the tracing last to export the spans of the shutdown
+func (s shutdown) manager(logger *log.Entry, timeout time.Duration) *lifecycle.Manager {
+	manager := lifecycle.New(logger)
+	manager.Timeout = timeout
+
+	manager.Add("http server", s.server)
+	manager.Add("scheduler", s.scheduler)
+	manager.Add("background jobs", s.jobs)
+	manager.Add("relays", s.relays)
+	manager.Add("backups", s.backups)
+	manager.Add("database", s.database)
+	manager.Add("tracing", s.tracing)
 
-	server.ListenAndServe(":80")
+	return manager
 }
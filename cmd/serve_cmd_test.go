@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/api"
+	"github.com/chaostreff-flensburg/moc/backup"
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/models/modelstest"
+	"github.com/chaostreff-flensburg/moc/relay"
+	"github.com/chaostreff-flensburg/moc/schedule"
+)
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-serve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db := modelstest.Open(t, filepath.Join(dir, "moc.db"))
+
+	// the delivery to the follower is a background job which hangs until
+	// released
+	release := make(chan struct{})
+	var delivered int32
+	inbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		atomic.StoreInt32(&delivered, 1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer inbox.Close()
+	require.NoError(t, db.Create(&models.Follower{Actor: inbox.URL + "/actor", Inbox: inbox.URL + "/inbox"}).Error)
+
+	cfg := &config.Config{OperatorToken: "secret"}
+	cfg.Server.Listen = "unix:" + filepath.Join(dir, "moc.sock")
+	cfg.Server.SocketMode = "0600"
+	cfg.ActivityPub.Enabled = true
+	cfg.ActivityPub.BaseURL = "http://localhost"
+	cfg.ActivityPub.Username = "moc"
+	cfg.ActivityPub.KeyPath = filepath.Join(dir, "actor.pem")
+	cfg.ActivityPub.AllowPrivate = true
+
+	server := api.NewAPI(db, cfg)
+	go server.ListenAndServe()
+
+	dispatcher := &relay.Dispatcher{}
+	go dispatcher.Run(context.Background())
+	server.SetDispatcher(dispatcher)
+
+	scheduler := schedule.NewScheduler(db)
+	go scheduler.Run(context.Background())
+
+	// what the request and the job left once the database closes
+	var messages, deliveredBeforeClose int
+	manager := shutdown{
+		server:    server.Shutdown,
+		scheduler: scheduler.Shutdown,
+		jobs:      server.Drain,
+		relays:    dispatcher.Shutdown,
+		backups:   backup.Periodic(db.DB(), filepath.Join(dir, "backups"), time.Hour, 1, log.WithField("test", "serve")),
+		database: func(ctx context.Context) error {
+			db.Model(&models.Message{}).Count(&messages)
+			deliveredBeforeClose = int(atomic.LoadInt32(&delivered))
+			return db.Close()
+		},
+		tracing: func(ctx context.Context) error { return nil },
+	}.manager(log.WithField("test", "serve"), 10*time.Second)
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("unix", filepath.Join(dir, "moc.sock"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer conn.Close()
+
+	// the request is in flight with half of its body when the shutdown starts
+	body := `{"message":"Hackspace is open"}`
+	fmt.Fprintf(conn, "POST /messages HTTP/1.1\r\nHost: localhost\r\nAuthorization: Bearer secret\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body[:10])
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- manager.Shutdown()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprint(conn, body[10:])
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// the shutdown waits for the job
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown ended before the background job: %v", err)
+	default:
+	}
+	close(release)
+
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, messages)
+	assert.Equal(t, 1, deliveredBeforeClose)
+}
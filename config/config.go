@@ -1,38 +1,273 @@
 package config
 
 import (
-	env "github.com/Netflix/go-env"
+	"strconv"
+	"strings"
+
 	log "github.com/sirupsen/logrus"
 )
 
+// Config of moc, every setting can be set in the config file, by env var or
+// by flag. The tags name the setting and document the default.
 type Config struct {
 	Database struct {
-		Driver string `env:"DATABASE_DRIVER"`
-		Path   string `env:"DATABASE_PATH"`
-	}
+		Driver string `env:"DATABASE_DRIVER" yaml:"driver" help:"database driver, sqlite3 or mysql"`
+		Path   string `env:"DATABASE_PATH" yaml:"path" help:"database file or mysql dsn" secret:"true"`
+
+		ConnectRetries  int `env:"DATABASE_CONNECT_RETRIES" yaml:"connect_retries" default:"10" help:"retries of a failed connect"`
+		ConnectBackoff  int `env:"DATABASE_CONNECT_BACKOFF" yaml:"connect_backoff" default:"500" help:"milliseconds before the first retry, doubled on every retry"`
+		ConnectTimeout  int `env:"DATABASE_CONNECT_TIMEOUT" yaml:"connect_timeout" default:"60" help:"seconds until connecting gives up"`
+		MaxOpenConns    int `env:"DATABASE_MAX_OPEN_CONNS" yaml:"max_open_conns" help:"open connections, unlimited if 0"`
+		MaxIdleConns    int `env:"DATABASE_MAX_IDLE_CONNS" yaml:"max_idle_conns" default:"2" help:"idle connections kept in the pool"`
+		ConnMaxLifetime int `env:"DATABASE_CONN_MAX_LIFETIME" yaml:"conn_max_lifetime" help:"seconds a connection is reused, forever if 0"`
+	} `yaml:"database"`
+
+	Backup struct {
+		Dir      string `env:"BACKUP_DIR" yaml:"dir" help:"directory of the backups taken by serve and moc backup"`
+		Interval int    `env:"BACKUP_INTERVAL" yaml:"interval" help:"minutes between two backups by serve, disabled if 0"`
+		Keep     int    `env:"BACKUP_KEEP" yaml:"keep" default:"7" help:"backups kept in the directory, the oldest are removed"`
+	} `yaml:"backup"`
+
+	OperatorToken string `env:"OPERATOR_TOKEN" yaml:"operator_token" help:"bearer token of the operators" secret:"true"`
+
+	Server struct {
+		Listen     string `env:"LISTEN" yaml:"listen" default:":80" help:"comma separated addresses, unix:/path for a unix socket"`
+		SocketMode string `env:"SOCKET_MODE" yaml:"socket_mode" default:"0660" help:"file mode of unix sockets"`
+		TLSCert    string `env:"TLS_CERT" yaml:"tls_cert" help:"certificate file, reloaded on SIGHUP"`
+		TLSKey     string `env:"TLS_KEY" yaml:"tls_key" help:"key file of the certificate"`
+
+		ShutdownTimeout int `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" default:"30" help:"seconds to finish requests and relays on shutdown"`
+	} `yaml:"server"`
+
+	Log struct {
+		Level      string `env:"LOG_LEVEL" yaml:"level" default:"info" help:"debug, info, warn or error"`
+		Format     string `env:"LOG_FORMAT" yaml:"format" default:"text" help:"text, logfmt or json"`
+		File       string `env:"LOG_FILE" yaml:"file" help:"log file, stderr if empty"`
+		Access     bool   `env:"ACCESS_LOG" yaml:"access" default:"true" help:"log every request"`
+		AccessFile string `env:"ACCESS_LOG_FILE" yaml:"access_file" help:"access log file, the log if empty"`
+	} `yaml:"log"`
+
+	Tracing struct {
+		Exporter    string `env:"TRACING_EXPORTER" yaml:"exporter" help:"otlp, stdout or empty to disable tracing and metrics"`
+		Endpoint    string `env:"TRACING_ENDPOINT" yaml:"endpoint" help:"otlp http endpoint like http://localhost:4318"`
+		ServiceName string `env:"TRACING_SERVICE_NAME" yaml:"service_name" default:"moc" help:"service name of the spans"`
+	} `yaml:"tracing"`
+
+	ActivityPub struct {
+		Enabled  bool   `env:"ACTIVITYPUB_ENABLED" yaml:"enabled" help:"publish messages to the fediverse"`
+		BaseURL  string `env:"ACTIVITYPUB_BASE_URL" yaml:"base_url" help:"public url of moc"`
+		Username string `env:"ACTIVITYPUB_USERNAME" yaml:"username" default:"moc" help:"name of the actor"`
+		KeyPath  string `env:"ACTIVITYPUB_KEY_PATH" yaml:"key_path" help:"private key of the actor, created if missing"`
+
+		AllowPrivate bool `env:"ACTIVITYPUB_ALLOW_PRIVATE" yaml:"allow_private" help:"also talk to plain http and private addresses, only for tests"`
+	} `yaml:"activitypub"`
+
+	Relay struct {
+		Enabled      string `env:"RELAYS" yaml:"enabled" help:"comma separated relays started by serve"`
+		PollInterval int    `env:"RELAY_POLL_INTERVAL" yaml:"poll_interval" default:"5" help:"seconds between two database polls"`
+	} `yaml:"relay"`
+
+	Scheduler struct {
+		Interval int `env:"SCHEDULER_INTERVAL" yaml:"interval" default:"5" help:"seconds between two checks for due recurring messages, disabled if 0"`
+		Grace    int `env:"SCHEDULER_GRACE" yaml:"grace" default:"300" help:"seconds a recurring message is still sent late, older ones missed while moc was down are skipped"`
+	} `yaml:"scheduler"`
+
+	IRC struct {
+		Address      string `env:"IRC_ADDRESS" yaml:"address" help:"irc server like irc.libera.chat:6697"`
+		TLS          bool   `env:"IRC_TLS" yaml:"tls" help:"connect with tls"`
+		Nick         string `env:"IRC_NICK" yaml:"nick" help:"nick of the bot"`
+		User         string `env:"IRC_USER" yaml:"user" help:"user name, defaults to the nick"`
+		FullName     string `env:"IRC_FULLNAME" yaml:"full_name" help:"real name, defaults to the nick"`
+		Password     string `env:"IRC_PASSWORD" yaml:"password" help:"server password" secret:"true"`
+		Channel      string `env:"IRC_CHANNEL" yaml:"channel" help:"comma separated channels"`
+		SASLUser     string `env:"IRC_SASL_USER" yaml:"sasl_user" help:"sasl plain user"`
+		SASLPassword string `env:"IRC_SASL_PASSWORD" yaml:"sasl_password" help:"sasl plain password" secret:"true"`
+	} `yaml:"irc"`
+
+	Mail struct {
+		Host            string `env:"SMTP_HOST" yaml:"host" help:"smtp server"`
+		Port            int    `env:"SMTP_PORT" yaml:"port" default:"587" help:"smtp port"`
+		Username        string `env:"SMTP_USERNAME" yaml:"username" help:"smtp user"`
+		Password        string `env:"SMTP_PASSWORD" yaml:"password" help:"smtp password" secret:"true"`
+		Security        string `env:"SMTP_SECURITY" yaml:"security" default:"starttls" help:"starttls, tls or none"`
+		From            string `env:"MAIL_FROM" yaml:"from" help:"sender address"`
+		BaseURL         string `env:"MAIL_BASE_URL" yaml:"base_url" help:"public url of moc for the links in mails"`
+		SubjectTemplate string `env:"MAIL_SUBJECT_TEMPLATE" yaml:"subject_template" help:"template of the subject"`
+		BodyTemplate    string `env:"MAIL_BODY_TEMPLATE" yaml:"body_template" help:"template of the body"`
+	} `yaml:"mail"`
+
+	Matrix struct {
+		Homeserver  string `env:"MATRIX_HOMESERVER" yaml:"homeserver" help:"homeserver like https://matrix.org"`
+		User        string `env:"MATRIX_USER" yaml:"user" help:"user of the bot"`
+		Password    string `env:"MATRIX_PASSWORD" yaml:"password" help:"password of the bot" secret:"true"`
+		AccessToken string `env:"MATRIX_ACCESS_TOKEN" yaml:"access_token" help:"access token instead of a password" secret:"true"`
+		Rooms       string `env:"MATRIX_ROOMS" yaml:"rooms" help:"comma separated room ids or aliases"`
+	} `yaml:"matrix"`
 
-	OperatorToken string `env:"OPERATOR_TOKEN"`
+	Telegram struct {
+		Endpoint string `env:"TELEGRAM_ENDPOINT" yaml:"endpoint" default:"https://api.telegram.org" help:"bot api endpoint"`
+		Token    string `env:"TELEGRAM_TOKEN" yaml:"token" help:"bot token" secret:"true"`
+		Chats    string `env:"TELEGRAM_CHATS" yaml:"chats" help:"comma separated chat ids or @channels"`
+	} `yaml:"telegram"`
 }
 
-// ReadConfig from env
+// ReadConfig from env and the file of MOC_CONFIG
 func ReadConfig() *Config {
-	var config Config
-	_, err := env.UnmarshalFromEnviron(&config)
+	config, err := Load("", nil)
 	if err != nil {
-		log.Fatal(err)
+		Fatal(err)
+	}
+
+	return config
+}
+
+// Fatal logs all problems of a config and exits
+func Fatal(err error) {
+	if problems, ok := err.(Problems); ok {
+		for _, problem := range problems {
+			log.Error(problem)
+		}
+	} else {
+		log.Error(err)
+	}
+
+	log.Fatal("invalid config")
+}
+
+// Validate the config and return all problems at once
+func (c *Config) Validate() error {
+	problems := Problems{}
+
+	switch c.Database.Driver {
+	case "":
+		problems = append(problems, "Need "+describe("DATABASE_DRIVER"))
+	case "sqlite3", "mysql":
+	default:
+		problems = append(problems, "Only supported driver are sqlite3, mysql")
+	}
+
+	if c.Database.Path == "" {
+		problems = append(problems, "Need "+describe("DATABASE_PATH"))
+	}
+
+	for _, limit := range []struct {
+		env   string
+		value int
+	}{
+		{"DATABASE_CONNECT_RETRIES", c.Database.ConnectRetries},
+		{"DATABASE_CONNECT_BACKOFF", c.Database.ConnectBackoff},
+		{"DATABASE_CONNECT_TIMEOUT", c.Database.ConnectTimeout},
+		{"DATABASE_MAX_OPEN_CONNS", c.Database.MaxOpenConns},
+		{"DATABASE_MAX_IDLE_CONNS", c.Database.MaxIdleConns},
+		{"DATABASE_CONN_MAX_LIFETIME", c.Database.ConnMaxLifetime},
+		{"SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout},
+		{"BACKUP_INTERVAL", c.Backup.Interval},
+		{"SCHEDULER_INTERVAL", c.Scheduler.Interval},
+		{"SCHEDULER_GRACE", c.Scheduler.Grace},
+	} {
+		if limit.value < 0 {
+			problems = append(problems, describe(limit.env)+" must not be negative")
+		}
+	}
+
+	if c.Backup.Interval > 0 {
+		if c.Backup.Dir == "" {
+			problems = append(problems, "Need "+describe("BACKUP_DIR"))
+		}
+
+		if c.Database.Driver != "sqlite3" {
+			problems = append(problems, describe("BACKUP_INTERVAL")+" needs the driver sqlite3")
+		}
+	}
+
+	if c.Backup.Keep < 1 {
+		problems = append(problems, describe("BACKUP_KEEP")+" must be at least 1")
+	}
+
+	if len(c.Addresses()) == 0 {
+		problems = append(problems, "Need "+describe("LISTEN"))
+	}
+
+	if _, err := strconv.ParseUint(c.Server.SocketMode, 8, 32); err != nil {
+		problems = append(problems, describe("SOCKET_MODE")+" must be an octal file mode like 0660")
+	}
+
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		problems = append(problems, "Need both "+describe("TLS_CERT")+" and "+describe("TLS_KEY"))
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		problems = append(problems, describe("LOG_LEVEL")+" must be debug, info, warn or error")
+	}
+
+	switch c.Log.Format {
+	case "text", "logfmt", "json":
+	default:
+		problems = append(problems, describe("LOG_FORMAT")+" must be text, logfmt or json")
+	}
+
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		problems = append(problems, describe("TRACING_EXPORTER")+" must be otlp, stdout or empty")
 	}
 
-	if config.Database.Driver == "" {
-		log.Fatal("Need DATABASE_DRIVER env var")
+	if c.ActivityPub.Enabled {
+		if c.ActivityPub.BaseURL == "" {
+			problems = append(problems, "Need "+describe("ACTIVITYPUB_BASE_URL"))
+		}
+
+		if c.ActivityPub.KeyPath == "" {
+			problems = append(problems, "Need "+describe("ACTIVITYPUB_KEY_PATH"))
+		}
 	}
 
-	if config.Database.Driver != "sqlite3" && config.Database.Driver != "mysql" {
-		log.Fatal("Only supported driver are sqlite3, mysql")
+	if c.Relay.PollInterval < 1 {
+		problems = append(problems, describe("RELAY_POLL_INTERVAL")+" must be at least 1")
 	}
 
-	if config.Database.Path == "" {
-		log.Fatal("Need DATABASE_PATH env var")
+	if c.Mail.Port < 1 || c.Mail.Port > 65535 {
+		problems = append(problems, describe("SMTP_PORT")+" must be between 1 and 65535")
+	}
+
+	switch c.Mail.Security {
+	case "starttls", "tls", "none":
+	default:
+		problems = append(problems, describe("SMTP_SECURITY")+" must be starttls, tls or none")
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+// Problems of an invalid config
+type Problems []string
+
+func (p Problems) Error() string {
+	return strings.Join(p, ", ")
+}
+
+// Relays enabled in the server
+func (c *Config) Relays() []string {
+	return List(c.Relay.Enabled)
+}
+
+// Addresses the server listens on
+func (c *Config) Addresses() []string {
+	return List(c.Server.Listen)
+}
+
+// List splits a comma separated config value
+func List(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
 
-	return &config
+	return list
 }
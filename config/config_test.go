@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	file, err := ioutil.TempFile("", "moc-config")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	file.WriteString(`
+database:
+  driver: sqlite3
+  path: /data/moc.sqlite3
+mail:
+  host: file.example.com
+  port: 25
+irc:
+  nick: moc
+`)
+	file.Close()
+
+	os.Setenv("SMTP_PORT", "2525")
+	os.Setenv("IRC_NICK", "moc-env")
+	defer os.Unsetenv("SMTP_PORT")
+	defer os.Unsetenv("IRC_NICK")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	Flags(flags)
+	require.NoError(t, flags.Parse([]string{"--irc-nick", "moc-flag", "--irc-tls"}))
+
+	config, err := Load(file.Name(), flags)
+	require.NoError(t, err)
+
+	// defaults
+	assert.Equal(t, 5, config.Relay.PollInterval)
+	assert.Equal(t, "starttls", config.Mail.Security)
+
+	// config file over defaults
+	assert.Equal(t, "sqlite3", config.Database.Driver)
+	assert.Equal(t, "file.example.com", config.Mail.Host)
+
+	// env over config file
+	assert.Equal(t, 2525, config.Mail.Port)
+
+	// flags over env
+	assert.Equal(t, "moc-flag", config.IRC.Nick)
+	assert.True(t, config.IRC.TLS)
+}
+
+func TestLoadProblems(t *testing.T) {
+	os.Setenv("SMTP_SECURITY", "ssl")
+	defer os.Unsetenv("SMTP_SECURITY")
+	os.Setenv("TLS_CERT", "/data/cert.pem")
+	defer os.Unsetenv("TLS_CERT")
+	os.Setenv("BACKUP_INTERVAL", "60")
+	defer os.Unsetenv("BACKUP_INTERVAL")
+
+	for _, name := range []string{"DATABASE_DRIVER", "DATABASE_PATH"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, "")
+	}
+
+	_, err := Load("", nil)
+	require.IsType(t, Problems{}, err)
+	assert.Equal(t, Problems{
+		"Need DATABASE_DRIVER (database.driver, --database-driver)",
+		"Need DATABASE_PATH (database.path, --database-path)",
+		"Need BACKUP_DIR (backup.dir, --backup-dir)",
+		"BACKUP_INTERVAL (backup.interval, --backup-interval) needs the driver sqlite3",
+		"Need both TLS_CERT (server.tls_cert, --tls-cert) and TLS_KEY (server.tls_key, --tls-key)",
+		"SMTP_SECURITY (mail.security, --smtp-security) must be starttls, tls or none",
+	}, err)
+}
+
+func TestPrint(t *testing.T) {
+	config := &Config{}
+	config.Database.Driver = "sqlite3"
+	config.Mail.Password = "hunter2"
+
+	var buf bytes.Buffer
+	require.NoError(t, config.Print(&buf))
+
+	assert.Contains(t, buf.String(), "  driver: sqlite3\n")
+	assert.Contains(t, buf.String(), "  password: REDACTED\n")
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), "  access_token: \"\"\n")
+}
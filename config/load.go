@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	env "github.com/Netflix/go-env"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Redacted replaces secrets in the printed config
+const Redacted = "REDACTED"
+
+// setting is a single field of the config
+type setting struct {
+	env    string
+	key    string
+	help   string
+	def    string
+	secret bool
+	value  reflect.Value
+}
+
+// Flag name of the setting like smtp-host for SMTP_HOST
+func (s setting) Flag() string {
+	return strings.Replace(strings.ToLower(s.env), "_", "-", -1)
+}
+
+// settings of all fields of a config
+func settings(c *Config) []setting {
+	list := []setting{}
+
+	var walk func(v reflect.Value, section string)
+	walk = func(v reflect.Value, section string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := field.Tag.Get("yaml")
+
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), section+key+".")
+				continue
+			}
+
+			list = append(list, setting{
+				env:    field.Tag.Get("env"),
+				key:    section + key,
+				help:   field.Tag.Get("help"),
+				def:    field.Tag.Get("default"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+
+	return list
+}
+
+// describe a setting by all its names for problems
+func describe(envName string) string {
+	for _, s := range settings(&Config{}) {
+		if s.env == envName {
+			return fmt.Sprintf("%s (%s, --%s)", s.env, s.key, s.Flag())
+		}
+	}
+
+	return envName
+}
+
+// set a setting from its string representation
+func (s setting) set(value string) error {
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", s.env)
+		}
+		s.value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a number", s.env)
+		}
+		s.value.SetInt(int64(n))
+	}
+
+	return nil
+}
+
+// Flags adds a flag for every setting
+func Flags(flags *pflag.FlagSet) {
+	for _, s := range settings(&Config{}) {
+		help := fmt.Sprintf("%s (%s, %s)", s.help, s.env, s.key)
+
+		switch s.value.Kind() {
+		case reflect.Bool:
+			flags.Bool(s.Flag(), s.def == "true", help)
+		case reflect.Int:
+			n, _ := strconv.Atoi(s.def)
+			flags.Int(s.Flag(), n, help)
+		default:
+			flags.String(s.Flag(), s.def, help)
+		}
+	}
+}
+
+// Load the config, later sources override earlier ones: defaults, the config
+// file, env vars and flags. The config file defaults to MOC_CONFIG and flags
+// may be nil. All problems are returned at once.
+func Load(path string, flags *pflag.FlagSet) (*Config, error) {
+	config := &Config{}
+	problems := Problems{}
+
+	for _, s := range settings(config) {
+		if s.def != "" {
+			s.set(s.def)
+		}
+	}
+
+	if path == "" {
+		path = os.Getenv("MOC_CONFIG")
+	}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, Problems{err.Error()}
+		}
+
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, Problems{fmt.Sprintf("bad config file %s: %v", path, err)}
+		}
+	}
+
+	if _, err := env.UnmarshalFromEnviron(config); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if flags != nil {
+		for _, s := range settings(config) {
+			flag := flags.Lookup(s.Flag())
+			if flag == nil || !flag.Changed {
+				continue
+			}
+
+			if err := s.set(flag.Value.String()); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		problems = append(problems, err.(Problems)...)
+	}
+
+	if len(problems) > 0 {
+		return config, problems
+	}
+
+	return config, nil
+}
+
+// Print the config as yaml with redacted secrets
+func (c *Config) Print(w io.Writer) error {
+	redacted := *c
+	for _, s := range settings(&redacted) {
+		if s.secret && s.value.String() != "" {
+			s.value.SetString(Redacted)
+		}
+	}
+
+	data, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
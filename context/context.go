@@ -46,6 +46,40 @@ func GetMessage(ctx context.Context) *models.Message {
 	return message.(*models.Message)
 }
 
+// WithTemplate set a template to context
+func WithTemplate(ctx context.Context, template *models.Template) context.Context {
+	ctx = context.WithValue(ctx, "template", template)
+
+	return ctx
+}
+
+// GetTemplate get context based template
+func GetTemplate(ctx context.Context) *models.Template {
+	template := ctx.Value("template")
+	if template == nil {
+		return nil
+	}
+
+	return template.(*models.Template)
+}
+
+// WithSchedule set a schedule to context
+func WithSchedule(ctx context.Context, schedule *models.Schedule) context.Context {
+	ctx = context.WithValue(ctx, "schedule", schedule)
+
+	return ctx
+}
+
+// GetSchedule get context based schedule
+func GetSchedule(ctx context.Context) *models.Schedule {
+	schedule := ctx.Value("schedule")
+	if schedule == nil {
+		return nil
+	}
+
+	return schedule.(*models.Schedule)
+}
+
 // SetOperator set operatorflag to context
 func SetOperator(ctx context.Context) context.Context {
 	ctx = context.WithValue(ctx, "isOperator", true)
@@ -0,0 +1,84 @@
+// Package database connects moc to its database
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+// maxBackoff between two connect attempts
+const maxBackoff = 30 * time.Second
+
+// Open connects to the configured database and tunes the connection pool.
+// A failed connect is retried with exponential backoff until the retries or
+// the timeout are used up or the context ends.
+func Open(ctx context.Context, cfg *config.Config) (*gorm.DB, error) {
+	if cfg.Database.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Database.ConnectTimeout)*time.Second)
+		defer cancel()
+	}
+
+	backoff := time.Duration(cfg.Database.ConnectBackoff) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		db, err := connect(ctx, cfg.Database.Driver, cfg.Database.Path)
+		if err == nil {
+			tune(db.DB(), cfg)
+			return db, nil
+		}
+
+		if attempt > cfg.Database.ConnectRetries {
+			return nil, errors.Wrapf(err, "connect to database, gave up after %d attempts", attempt)
+		}
+
+		log.WithError(err).Warnf("Database connect attempt %d failed, retry in %s", attempt, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(err, "connect to database, %s after %d attempts", ctx.Err(), attempt)
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// connect once, the ping ends with the context
+func connect(ctx context.Context, driver string, path string) (*gorm.DB, error) {
+	sqlDB, err := sql.Open(driver, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	db, err := gorm.Open(driver, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// tune the connection pool
+func tune(sqlDB *sql.DB, cfg *config.Config) {
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime) * time.Second)
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+func newConfig(path string) *config.Config {
+	cfg := &config.Config{}
+	cfg.Database.Driver = "sqlite3"
+	cfg.Database.Path = path
+	cfg.Database.ConnectRetries = 2
+	cfg.Database.ConnectBackoff = 10
+	cfg.Database.MaxOpenConns = 3
+
+	return cfg
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-database")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := Open(context.Background(), newConfig(filepath.Join(dir, "moc.db")))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 3, db.DB().Stats().MaxOpenConnections)
+}
+
+func TestOpenRetries(t *testing.T) {
+	// the directory of the file does not exist
+	cfg := newConfig("/nonexistent/moc.db")
+
+	start := time.Now()
+	_, err := Open(context.Background(), cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gave up after 3 attempts")
+	assert.Contains(t, err.Error(), "unable to open database file")
+
+	// backoff of 10ms and 20ms
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+
+	// the context ends the retries
+	cfg.Database.ConnectRetries = 100
+	cfg.Database.ConnectBackoff = 1000
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start = time.Now()
+	_, err = Open(ctx, cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "context canceled after 1 attempts")
+	assert.True(t, time.Since(start) < time.Second)
+
+	// so does the timeout
+	cfg.Database.ConnectTimeout = 1
+
+	start = time.Now()
+	_, err = Open(context.Background(), cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "context deadline exceeded")
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
@@ -0,0 +1,82 @@
+// Package lifecycle shuts the parts of the server down in order, so no part
+// is stopped while another one still needs it
+package lifecycle
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTimeout of a shutdown
+const DefaultTimeout = 30 * time.Second
+
+// StopFunc stops a part of the server, it has to give up once the context
+// ends
+type StopFunc func(ctx context.Context) error
+
+type stage struct {
+	name string
+	stop StopFunc
+}
+
+// Manager stops the parts one after another in the order they were added
+type Manager struct {
+	// Timeout of the whole shutdown, parts which are stopped last get what
+	// is left of it
+	Timeout time.Duration
+
+	stages []stage
+	log    *logrus.Entry
+}
+
+// New creates a manager without parts
+func New(log *logrus.Entry) *Manager {
+	return &Manager{
+		Timeout: DefaultTimeout,
+		log:     log,
+	}
+}
+
+// Add a part which is stopped after all parts added before
+func (m *Manager) Add(name string, stop StopFunc) {
+	m.stages = append(m.stages, stage{name: name, stop: stop})
+}
+
+// Wait until the context ends and shut down
+func (m *Manager) Wait(ctx context.Context) error {
+	<-ctx.Done()
+
+	return m.Shutdown()
+}
+
+// Shutdown stops all parts, a failed part does not keep the later ones
+// running
+func (m *Manager) Shutdown() error {
+	m.log.Infof("Shutdown, in at most %s", m.Timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+
+	failed := []string{}
+	for _, stage := range m.stages {
+		start := time.Now()
+
+		if err := stage.stop(ctx); err != nil {
+			m.log.WithError(err).Errorf("Stop %s failed", stage.name)
+			failed = append(failed, stage.name)
+			continue
+		}
+
+		m.log.Infof("Stopped %s in %s", stage.name, time.Since(start))
+	}
+
+	if len(failed) > 0 {
+		return errors.Errorf("stop %s failed", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
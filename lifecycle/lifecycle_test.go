@@ -0,0 +1,70 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	manager := New(logrus.WithField("test", "lifecycle"))
+
+	stopped := []string{}
+	stop := func(name string, err error) StopFunc {
+		return func(ctx context.Context) error {
+			stopped = append(stopped, name)
+			return err
+		}
+	}
+
+	manager.Add("http server", stop("http server", nil))
+	manager.Add("background jobs", stop("background jobs", errors.New("jobs stuck")))
+	manager.Add("relays", stop("relays", nil))
+	manager.Add("database", stop("database", nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error)
+	go func() {
+		done <- manager.Wait(ctx)
+	}()
+
+	// nothing is stopped before the signal
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, stopped)
+
+	cancel()
+	err := <-done
+
+	// a failed part does not keep the later ones running
+	require.EqualError(t, err, "stop background jobs failed")
+	assert.Equal(t, []string{"http server", "background jobs", "relays", "database"}, stopped)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	manager := New(logrus.WithField("test", "lifecycle"))
+	manager.Timeout = 50 * time.Millisecond
+
+	manager.Add("http server", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	closed := false
+	manager.Add("database", func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	start := time.Now()
+	require.EqualError(t, manager.Shutdown(), "stop http server failed")
+	assert.True(t, time.Since(start) < time.Second)
+
+	// the database is closed even if the requests are not drained in time
+	assert.True(t, closed)
+}
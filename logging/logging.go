@@ -0,0 +1,59 @@
+// Package logging sets up the logs of moc from the config
+package logging
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+// Configure the standard logger used by all packages
+func Configure(cfg *config.Config) error {
+	return apply(logrus.StandardLogger(), cfg, cfg.Log.File)
+}
+
+// New creates a logger with the level and format of the config writing to
+// its own file
+func New(cfg *config.Config, file string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	if err := apply(logger, cfg, file); err != nil {
+		return nil, err
+	}
+
+	return logger, nil
+}
+
+// apply the level and format of the config to a logger, an empty file is
+// stderr
+func apply(logger *logrus.Logger, cfg *config.Config, file string) error {
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(level)
+
+	switch cfg.Log.Format {
+	case "json":
+		logger.Formatter = &logrus.JSONFormatter{}
+	case "logfmt":
+		logger.Formatter = &logrus.TextFormatter{DisableColors: true, FullTimestamp: true}
+	default:
+		logger.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	}
+
+	var out io.Writer = os.Stderr
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return errors.Wrap(err, "open log file")
+		}
+		out = f
+	}
+	logger.Out = out
+
+	return nil
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	// time zones of the schedules on hosts without zoneinfo
+	_ "time/tzdata"
+
 	"github.com/chaostreff-flensburg/moc/cmd"
 )
 
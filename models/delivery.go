@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Delivery states
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryRetracted = "retracted"
+
+	// DeliveryKept the message was deleted but the relay can't retract it
+	DeliveryKept = "kept"
+)
+
+// Delivery tracks a message handed to a relay like irc or telegram
+type Delivery struct {
+	ID string `gorm:"type:uuid; primary_key" json:"id"`
+
+	Relay     string `gorm:"index:idx_delivery_relay_message" json:"relay"`
+	MessageID string `gorm:"index:idx_delivery_relay_message" json:"message_id"`
+
+	Status   string `json:"status"`
+	RemoteID string `json:"remote_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+
+	// RetractAttempts of a deleted message, it is kept once they reach the
+	// max attempts of the relay
+	RetractAttempts int `json:"retract_attempts,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate will create a uuid right before creating
+func (d *Delivery) BeforeCreate(scope *gorm.Scope) error {
+	scope.SetColumn("ID", uuid.New().String())
+
+	return nil
+}
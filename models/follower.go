@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// Follower is a remote ActivityPub actor following moc
+type Follower struct {
+	ID string `gorm:"type:uuid; primary_key" json:"id"`
+
+	Actor string `gorm:"unique_index" json:"actor"`
+	Inbox string `json:"inbox"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BeforeCreate will create a uuid right before creating
+func (f *Follower) BeforeCreate(scope *gorm.Scope) error {
+	scope.SetColumn("ID", uuid.New().String())
+
+	return nil
+}
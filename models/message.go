@@ -14,11 +14,28 @@ type MessageRequest struct {
 	Text string `json:"message" validate:"required,min=3,max=160"`
 }
 
+// MessageBatchRequest creates many messages at once
+type MessageBatchRequest struct {
+	Messages []MessageRequest `json:"messages" validate:"required"`
+}
+
+// MessageBatchResult is the created message of an item of a batch
+type MessageBatchResult struct {
+	Index   int      `json:"index"`
+	Message *Message `json:"message"`
+}
+
 type Message struct {
 	MessageRequest
 
 	ID string `gorm:"type:uuid; primary_key" json:"id"`
 
+	// TemplateID of the template which rendered the message
+	TemplateID *string `gorm:"type:uuid" json:"template_id,omitempty"`
+
+	// ScheduleID of the schedule which created the message
+	ScheduleID *string `gorm:"type:uuid" json:"schedule_id,omitempty"`
+
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
@@ -33,8 +50,12 @@ func NewMessage(text string) *Message {
 	}
 }
 
-// BeforeCreate will create a uuid right before creating
+// BeforeCreate will create a uuid right before creating, imported messages
+// keep their id
 func (m *Message) BeforeCreate(scope *gorm.Scope) error {
+	if m.ID != "" {
+		return nil
+	}
 	scope.SetColumn("ID", uuid.New().String())
 
 	return nil
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// All returns every model managed by the database migration
+func All() []interface{} {
+	return []interface{}{
+		&Message{},
+		&Follower{},
+		&Delivery{},
+		&Subscriber{},
+		&Template{},
+		&Schedule{},
+	}
+}
+
+// Pending lists the tables and columns the migration has still to create
+func Pending(db *gorm.DB) []string {
+	pending := []string{}
+
+	for _, model := range All() {
+		scope := db.NewScope(model)
+		table := scope.TableName()
+
+		if !scope.Dialect().HasTable(table) {
+			pending = append(pending, table)
+			continue
+		}
+
+		for _, field := range scope.GetModelStruct().StructFields {
+			if !field.IsNormal || field.IsIgnored {
+				continue
+			}
+
+			if !scope.Dialect().HasColumn(table, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+	}
+
+	return pending
+}
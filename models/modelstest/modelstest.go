@@ -0,0 +1,38 @@
+// Package modelstest opens migrated sqlite databases for tests.
+package modelstest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// Open the sqlite database at path, which may be a uri, and migrate all models
+func Open(t testing.TB, path string) *gorm.DB {
+	db, err := gorm.Open("sqlite3", path)
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models.All()...).Error)
+
+	return db
+}
+
+// TempDB opens a migrated database in a new directory, the returned func
+// closes it and removes the directory
+func TempDB(t testing.TB) (*gorm.DB, func()) {
+	dir, err := ioutil.TempDir("", "moc-test")
+	require.NoError(t, err)
+
+	db := Open(t, filepath.Join(dir, "moc.db"))
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/robfig/cron/v3"
+	v "gopkg.in/go-playground/validator.v9"
+
+	"github.com/chaostreff-flensburg/moc/validator"
+)
+
+// cronParser of the five standard fields, descriptors like @every are not
+// accepted so a schedule fires once a minute at most
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// parseCron expression, the time zone is set by its own field
+func parseCron(spec string) (cron.Schedule, error) {
+	if strings.Contains(spec, "TZ=") {
+		return nil, errors.New("time zone in cron expression")
+	}
+
+	return cronParser.Parse(spec)
+}
+
+type ScheduleRequest struct {
+	MessageRequest
+
+	// Cron has the five fields minute, hour, day of month, month and day of
+	// week, like 30 23 * * * for every night at 23:30
+	Cron     string     `json:"cron" validate:"required,max=100"`
+	TimeZone string     `json:"time_zone,omitempty" validate:"max=64"`
+	StartAt  *time.Time `json:"start_at,omitempty"`
+	EndAt    *time.Time `json:"end_at,omitempty"`
+}
+
+// Schedule creates a message on every occurrence of a cron expression
+type Schedule struct {
+	ScheduleRequest
+
+	ID string `gorm:"type:uuid; primary_key" json:"id"`
+
+	Paused bool `json:"paused"`
+
+	// LastRunAt is the last occurrence which was due, NextRunAt the next one
+	// or empty once the schedule ended
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// BeforeCreate will create a uuid right before creating
+func (s *Schedule) BeforeCreate(scope *gorm.Scope) error {
+	scope.SetColumn("ID", uuid.New().String())
+
+	return nil
+}
+
+// Validate request by annotations, the cron expression and the time zone
+func (r *ScheduleRequest) Validate() *map[string]string {
+	validate := validator.NewValidator()
+
+	errors := map[string]string{}
+
+	if err := validate.Struct(r); err != nil {
+		for _, err := range err.(v.ValidationErrors) {
+			errors[err.Field()] = err.ActualTag()
+		}
+	}
+
+	if _, ok := errors["cron"]; !ok {
+		if _, err := parseCron(r.Cron); err != nil {
+			errors["cron"] = "cron"
+		}
+	}
+
+	if _, ok := errors["time_zone"]; !ok {
+		if _, err := time.LoadLocation(r.TimeZone); err != nil {
+			errors["time_zone"] = "time_zone"
+		}
+	}
+
+	if r.StartAt != nil && r.EndAt != nil && !r.EndAt.After(*r.StartAt) {
+		errors["end_at"] = "after_start"
+	}
+
+	if len(errors) > 0 {
+		return &errors
+	}
+
+	return nil
+}
+
+// Location of the time zone, UTC if empty
+func (r *ScheduleRequest) Location() (*time.Location, error) {
+	return time.LoadLocation(r.TimeZone)
+}
+
+// Next occurrence after a time in UTC, nil if there is none before the end
+func (r *ScheduleRequest) Next(after time.Time) (*time.Time, error) {
+	schedule, err := parseCron(r.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	location, err := r.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	// the start itself is an occurrence
+	if r.StartAt != nil && after.Before(*r.StartAt) {
+		after = r.StartAt.Add(-time.Second)
+	}
+
+	next := schedule.Next(after.In(location))
+	if next.IsZero() || r.EndAt != nil && next.After(*r.EndAt) {
+		return nil, nil
+	}
+
+	next = next.UTC()
+	return &next, nil
+}
+
+// Upcoming occurrences after a time in the time zone of the schedule
+func (r *ScheduleRequest) Upcoming(after time.Time, count int) ([]time.Time, error) {
+	location, err := r.Location()
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := []time.Time{}
+	for len(occurrences) < count {
+		next, err := r.Next(after)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			break
+		}
+
+		occurrences = append(occurrences, next.In(location))
+		after = *next
+	}
+
+	return occurrences, nil
+}
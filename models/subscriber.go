@@ -0,0 +1,71 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	v "gopkg.in/go-playground/validator.v9"
+
+	"github.com/chaostreff-flensburg/moc/validator"
+)
+
+type SubscriberRequest struct {
+	Email string `gorm:"unique_index" json:"email" validate:"required,email,max=254"`
+}
+
+// Subscriber receives every message by e-mail once the address is confirmed
+type Subscriber struct {
+	SubscriberRequest
+
+	ID string `gorm:"type:uuid; primary_key" json:"id"`
+
+	// Token is the secret of the confirm and unsubscribe links
+	Token string `gorm:"unique_index" json:"-"`
+
+	ConfirmationSentAt *time.Time `json:"confirmation_sent_at,omitempty"`
+	ConfirmedAt        *time.Time `json:"confirmed_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewSubscriber create new unconfirmed subscriber
+func NewSubscriber(email string) *Subscriber {
+	token := make([]byte, 32)
+	rand.Read(token)
+
+	return &Subscriber{
+		SubscriberRequest: SubscriberRequest{
+			Email: email,
+		},
+		Token: hex.EncodeToString(token),
+	}
+}
+
+// BeforeCreate will create a uuid right before creating
+func (s *Subscriber) BeforeCreate(scope *gorm.Scope) error {
+	scope.SetColumn("ID", uuid.New().String())
+
+	return nil
+}
+
+// Validate request by annotations
+func (r *SubscriberRequest) Validate() *map[string]string {
+	validate := validator.NewValidator()
+
+	err := validate.Struct(r)
+	if err != nil {
+		errors := map[string]string{}
+
+		for _, err := range err.(v.ValidationErrors) {
+			errors[err.Field()] = err.ActualTag()
+		}
+
+		return &errors
+	}
+
+	return nil
+}
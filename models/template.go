@@ -0,0 +1,193 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	v "gopkg.in/go-playground/validator.v9"
+
+	"github.com/chaostreff-flensburg/moc/validator"
+)
+
+type TemplateRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+	Text string `json:"text" validate:"required,max=1000"`
+}
+
+// Template of recurring messages like "Talk {title} starts in {room}", {{
+// and }} are literal braces
+type Template struct {
+	TemplateRequest
+
+	ID string `gorm:"type:uuid; primary_key" json:"id"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// TemplateMessageRequest creates a message of a template
+type TemplateMessageRequest struct {
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// BeforeCreate will create a uuid right before creating
+func (t *Template) BeforeCreate(scope *gorm.Scope) error {
+	scope.SetColumn("ID", uuid.New().String())
+
+	return nil
+}
+
+// Validate request by annotations and the syntax of the text
+func (r *TemplateRequest) Validate() *map[string]string {
+	validate := validator.NewValidator()
+
+	errors := map[string]string{}
+
+	if err := validate.Struct(r); err != nil {
+		for _, err := range err.(v.ValidationErrors) {
+			errors[err.Field()] = err.ActualTag()
+		}
+	}
+
+	if _, ok := errors["text"]; !ok {
+		if _, err := parseTemplate(r.Text); err != nil {
+			errors["text"] = "template"
+		}
+	}
+
+	if len(errors) > 0 {
+		return &errors
+	}
+
+	return nil
+}
+
+// Variables of the text in order of their first use
+func (r *TemplateRequest) Variables() ([]string, error) {
+	segments, err := parseTemplate(r.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []string{}
+	seen := map[string]bool{}
+	for _, segment := range segments {
+		if segment.variable && !seen[segment.text] {
+			seen[segment.text] = true
+			variables = append(variables, segment.text)
+		}
+	}
+
+	return variables, nil
+}
+
+// Render the text with the values of the variables. Values are inserted as
+// they are without expanding braces, control characters like line breaks
+// become spaces so a value can't add lines to the relays.
+func (r *TemplateRequest) Render(values map[string]string) (string, error) {
+	segments, err := parseTemplate(r.Text)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+	var text strings.Builder
+	for _, segment := range segments {
+		if !segment.variable {
+			text.WriteString(segment.text)
+			continue
+		}
+
+		value, ok := values[segment.text]
+		if !ok {
+			missing = append(missing, segment.text)
+			continue
+		}
+		text.WriteString(escape(value))
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("missing variables %s", strings.Join(missing, ", "))
+	}
+
+	return text.String(), nil
+}
+
+// escape the control characters of a value
+func escape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, value)
+}
+
+// segment of a template is literal text or the name of a variable
+type segment struct {
+	text     string
+	variable bool
+}
+
+// parseTemplate splits a text into segments, a variable name consists of
+// letters, digits and underscores
+func parseTemplate(text string) ([]segment, error) {
+	segments := []segment{}
+	literal := strings.Builder{}
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case strings.HasPrefix(text[i:], "{{"), strings.HasPrefix(text[i:], "}}"):
+			literal.WriteByte(text[i])
+			i++
+		case text[i] == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { at %d", i)
+			}
+
+			name := text[i+1 : i+end]
+			if !validName(name) {
+				return nil, fmt.Errorf("bad variable name %q at %d", name, i)
+			}
+
+			if literal.Len() > 0 {
+				segments = append(segments, segment{text: literal.String()})
+				literal.Reset()
+			}
+			segments = append(segments, segment{text: name, variable: true})
+			i += end
+		case text[i] == '}':
+			return nil, fmt.Errorf("unopened } at %d", i)
+		default:
+			literal.WriteByte(text[i])
+		}
+	}
+
+	if literal.Len() > 0 {
+		segments = append(segments, segment{text: literal.String()})
+	}
+
+	return segments, nil
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
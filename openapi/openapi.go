@@ -0,0 +1,170 @@
+package openapi
+
+import "strings"
+
+// Version of the openapi specification
+const Version = "3.0.3"
+
+// Document is the root of an openapi document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info about the api
+type Info struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Contact     *Contact `json:"contact,omitempty"`
+	Version     string   `json:"version"`
+}
+
+// Contact of the maintainers
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Server serving the api
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps the lower case http methods of a path to their operations
+type PathItem map[string]*Operation
+
+// Operation on a path
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+// Parameter in the path or query
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody of an operation
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType of a request or response body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components are the reusable parts of a document
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme like a bearer token
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// Schema of a json value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// Operation returns the operation of a method and path
+func (d *Document) Operation(method string, path string) *Operation {
+	item, ok := d.Paths[path]
+	if !ok {
+		return nil
+	}
+
+	return (*item)[strings.ToLower(method)]
+}
+
+// AddOperation to a path
+func (d *Document) AddOperation(method string, path string, operation *Operation) {
+	if d.Paths == nil {
+		d.Paths = map[string]*PathItem{}
+	}
+
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+
+	(*item)[strings.ToLower(method)] = operation
+}
+
+// Resolve follows the reference of a schema
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[schema.Ref[len(refPrefix):]]
+	}
+
+	return schema
+}
+
+// Property resolves the schema of a value at a path of the validation
+// errors, like tags[0].name
+func (d *Document) Property(schema *Schema, path string) *Schema {
+	schema = d.Resolve(schema)
+	if path == "" || path == "body" {
+		return schema
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		index := strings.Index(name, "[")
+		if index < 0 {
+			index = len(name)
+		}
+
+		if schema == nil {
+			return nil
+		}
+		if property, ok := schema.Properties[name[:index]]; ok {
+			schema = d.Resolve(property)
+		} else {
+			schema = d.Resolve(schema.AdditionalProperties)
+		}
+
+		for i := strings.Count(name[index:], "["); i > 0 && schema != nil; i-- {
+			schema = d.Resolve(schema.Items)
+		}
+	}
+
+	return schema
+}
@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// refPrefix of references to component schemas
+const refPrefix = "#/components/schemas/"
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schemas generates schemas from go types. Named structs are added to the
+// components and referenced, the json tags name the properties and the
+// validate tags add the constraints.
+type Schemas map[string]*Schema
+
+// For returns the schema of the type of a value
+func (s Schemas) For(value interface{}) *Schema {
+	if value == nil {
+		return &Schema{}
+	}
+
+	return s.schema(reflect.TypeOf(value))
+}
+
+func (s Schemas) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schema(t.Elem())
+		if schema.Ref != "" {
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+
+		if _, ok := s[t.Name()]; !ok {
+			// reserve the name first for recursive types
+			s[t.Name()] = &Schema{}
+			*s[t.Name()] = *s.object(t)
+		}
+		return &Schema{Ref: refPrefix + t.Name()}
+	}
+
+	return &Schema{}
+}
+
+// object builds the schema of a struct, fields of embedded structs are
+// promoted like encoding/json does
+func (s Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(schema, t)
+
+	return schema
+}
+
+func (s Schemas) fields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, options = tag[:i], tag[i+1:]
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.fields(schema, field.Type)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.schema(field.Type)
+		if strings.Contains(field.Tag.Get("gorm"), "type:uuid") {
+			property.Format = "uuid"
+		}
+
+		required := !strings.Contains(options, "omitempty")
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			required = constrain(property, rule) || required
+		}
+
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// constrain a schema by a validate rule and return if the rule makes the
+// property required
+func constrain(schema *Schema, rule string) bool {
+	name, param := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, param = rule[:i], rule[i+1:]
+	}
+
+	n, err := strconv.Atoi(param)
+	hasParam := err == nil
+
+	switch {
+	case name == "required":
+		return true
+	case name == "email":
+		schema.Format = "email"
+	case name == "uuid":
+		schema.Format = "uuid"
+	case name == "url":
+		schema.Format = "uri"
+	case name == "min" && hasParam && schema.Type == "string":
+		schema.MinLength = &n
+	case name == "max" && hasParam && schema.Type == "string":
+		schema.MaxLength = &n
+	case name == "min" && hasParam:
+		f := float64(n)
+		schema.Minimum = &f
+	case name == "max" && hasParam:
+		f := float64(n)
+		schema.Maximum = &f
+	}
+
+	return false
+}
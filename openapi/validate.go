@@ -0,0 +1,200 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Errors maps the path of invalid values to the violated rule, the rules are
+// named like the validate tags the schemas are generated from
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	paths := make([]string, 0, len(e))
+	for path := range e {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	messages := make([]string, 0, len(paths))
+	for _, path := range paths {
+		messages = append(messages, fmt.Sprintf("%s: %s", path, e[path]))
+	}
+
+	return strings.Join(messages, ", ")
+}
+
+// ValidateJSON decodes data and validates it against a schema
+func (d *Document) ValidateJSON(schema *Schema, data []byte) Errors {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return Errors{"body": "json"}
+	}
+
+	errors := d.Validate(schema, value)
+	if rule, ok := errors[""]; ok {
+		delete(errors, "")
+		errors["body"] = rule
+	}
+
+	return errors
+}
+
+// ValidateParameters of an operation in the path or query, values holds
+// the raw value of every present parameter
+func (d *Document) ValidateParameters(operation *Operation, in string, values map[string]string) Errors {
+	errors := Errors{}
+
+	for _, parameter := range operation.Parameters {
+		if parameter.In != in {
+			continue
+		}
+
+		raw, ok := values[parameter.Name]
+		if !ok || raw == "" {
+			if parameter.Required {
+				errors[parameter.Name] = "required"
+			}
+			continue
+		}
+
+		var value interface{} = raw
+		schema := d.Resolve(parameter.Schema)
+		if schema != nil && schema.Type != "string" && schema.Type != "" {
+			// non string params are plain json like 42 or true
+			if err := json.Unmarshal([]byte(raw), &value); err != nil {
+				errors[parameter.Name] = "type"
+				continue
+			}
+		}
+
+		d.validate(errors, parameter.Name, schema, value)
+	}
+
+	if len(errors) == 0 {
+		return nil
+	}
+
+	return errors
+}
+
+// Validate a decoded json value against a schema, nil means valid
+func (d *Document) Validate(schema *Schema, value interface{}) Errors {
+	errors := Errors{}
+	d.validate(errors, "", schema, value)
+
+	if len(errors) == 0 {
+		return nil
+	}
+
+	return errors
+}
+
+func (d *Document) validate(errors Errors, path string, schema *Schema, value interface{}) {
+	schema = d.Resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			errors[path] = "required"
+		}
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			errors[path] = "type"
+			return
+		}
+
+		length := utf8.RuneCountInString(s)
+		if length == 0 && schema.MinLength != nil && *schema.MinLength > 0 {
+			errors[path] = "required"
+		} else if schema.MinLength != nil && length < *schema.MinLength {
+			errors[path] = "min"
+		} else if schema.MaxLength != nil && length > *schema.MaxLength {
+			errors[path] = "max"
+		} else if !validFormat(schema.Format, s) {
+			errors[path] = schema.Format
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok || schema.Type == "integer" && n != float64(int64(n)) {
+			errors[path] = "type"
+		} else if schema.Minimum != nil && n < *schema.Minimum {
+			errors[path] = "min"
+		} else if schema.Maximum != nil && n > *schema.Maximum {
+			errors[path] = "max"
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errors[path] = "type"
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			errors[path] = "type"
+			return
+		}
+
+		for i, item := range items {
+			d.validate(errors, fmt.Sprintf("%s[%d]", path, i), schema.Items, item)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errors[path] = "type"
+			return
+		}
+
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				errors[join(path, name)] = "required"
+			}
+		}
+
+		for name, property := range object {
+			if propertySchema, ok := schema.Properties[name]; ok {
+				d.validate(errors, join(path, name), propertySchema, property)
+			} else if schema.AdditionalProperties != nil {
+				d.validate(errors, join(path, name), schema.AdditionalProperties, property)
+			}
+		}
+	}
+}
+
+// validFormat checks the formats used by the generated schemas
+func validFormat(format string, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	}
+
+	return true
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
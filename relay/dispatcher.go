@@ -0,0 +1,151 @@
+package relay
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/chaostreff-flensburg/moc/config"
+)
+
+// Dispatcher feeds message changes of the api to all enabled relays, every
+// relay has its own queue so a slow relay does not block the others
+type Dispatcher struct {
+	pollers []*Poller
+
+	once      sync.Once
+	abortOnce sync.Once
+	abort     chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	started bool
+}
+
+// NewDispatcher opens all relays enabled in the config
+func NewDispatcher(ctx context.Context, config *config.Config, db *gorm.DB) (*Dispatcher, error) {
+	dispatcher := &Dispatcher{}
+
+	for _, name := range config.Relays() {
+		poller, err := Open(ctx, name, config, db)
+		if err != nil {
+			return nil, err
+		}
+
+		dispatcher.pollers = append(dispatcher.pollers, poller)
+	}
+
+	return dispatcher, nil
+}
+
+// Add a poller, used for relays which are not in the registry
+func (d *Dispatcher) Add(poller *Poller) {
+	d.pollers = append(d.pollers, poller)
+}
+
+// init the channels of Run and Shutdown
+func (d *Dispatcher) init() {
+	d.once.Do(func() {
+		d.abort = make(chan struct{})
+		d.done = make(chan struct{})
+	})
+}
+
+// Run all relays until the context is canceled or Shutdown
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.init()
+	defer close(d.done)
+
+	d.mu.Lock()
+	d.started = true
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-d.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+
+	for _, poller := range d.pollers {
+		wg.Add(1)
+		go func(poller *Poller) {
+			defer wg.Done()
+
+			if err := poller.Run(ctx); err != nil {
+				poller.log.WithError(err).Error("relay stopped")
+			}
+		}(poller)
+	}
+
+	wg.Wait()
+}
+
+// running reports if Run was started
+func (d *Dispatcher) running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.started
+}
+
+// Shutdown stops all relays once their queued events are handled, relays
+// still busy when the context ends are canceled. It returns right away if
+// Run was never started and may be called more than once.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	d.init()
+
+	for _, poller := range d.pollers {
+		poller.Stop()
+	}
+
+	if !d.running() {
+		return nil
+	}
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.abortOnce.Do(func() {
+			close(d.abort)
+		})
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+// Dispatch an event to all relays
+func (d *Dispatcher) Dispatch(event Event) {
+	if d == nil {
+		return
+	}
+
+	for _, poller := range d.pollers {
+		poller.Notify(event)
+	}
+}
+
+// Status of all relays
+func (d *Dispatcher) Status(ctx context.Context) []Status {
+	status := []Status{}
+	if d == nil {
+		return status
+	}
+
+	for _, poller := range d.pollers {
+		status = append(status, poller.Status(ctx))
+	}
+
+	return status
+}
@@ -0,0 +1,416 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLine of irc including the trailing CRLF
+const maxLine = 512
+
+// maxHost in the prefix the server adds to lines relayed to the channel
+const maxHost = 63
+
+// Config of the irc connection
+type Config struct {
+	Address  string
+	TLS      bool
+	Nick     string
+	User     string
+	RealName string
+	Password string
+	Channels []string
+
+	SASLUser     string
+	SASLPassword string
+
+	// TLSConfig overrides the default tls configuration
+	TLSConfig *tls.Config
+
+	// flood control, Burst lines at once and one more line every Rate
+	Burst int
+	Rate  time.Duration
+
+	// reconnect delay doubles on every failed attempt up to MaxReconnectDelay
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// RegisterTimeout to wait for the welcome of the server
+	RegisterTimeout time.Duration
+}
+
+// outgoing line with a channel to report the write result
+type outgoing struct {
+	line string
+	done chan error
+}
+
+// Client keeps a connection to an irc server and posts messages to channels
+type Client struct {
+	config    Config
+	log       *logrus.Entry
+	outgoing  chan *outgoing
+	connected int32
+}
+
+// NewClient creates a client, call Run to connect
+func NewClient(config Config, log *logrus.Entry) *Client {
+	if config.User == "" {
+		config.User = config.Nick
+	}
+	if config.RealName == "" {
+		config.RealName = config.Nick
+	}
+	if config.Burst <= 0 {
+		config.Burst = 4
+	}
+	if config.Rate <= 0 {
+		config.Rate = 2 * time.Second
+	}
+	if config.ReconnectDelay <= 0 {
+		config.ReconnectDelay = time.Second
+	}
+	if config.MaxReconnectDelay <= 0 {
+		config.MaxReconnectDelay = 5 * time.Minute
+	}
+	if config.RegisterTimeout <= 0 {
+		config.RegisterTimeout = 30 * time.Second
+	}
+
+	return &Client{
+		config:   config,
+		log:      log,
+		outgoing: make(chan *outgoing),
+	}
+}
+
+// Run connects to the server and reconnects until the context is canceled
+func (c *Client) Run(ctx context.Context) error {
+	delay := c.config.ReconnectDelay
+
+	for {
+		started := time.Now()
+
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// a session which lasted a while resets the backoff
+		if time.Since(started) > c.config.MaxReconnectDelay {
+			delay = c.config.ReconnectDelay
+		}
+
+		c.log.WithError(err).Warnf("irc connection lost, reconnect in %s", delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > c.config.MaxReconnectDelay {
+			delay = c.config.MaxReconnectDelay
+		}
+	}
+}
+
+// Connected reports if the client is registered and joined the channels
+func (c *Client) Connected() bool {
+	return atomic.LoadInt32(&c.connected) == 1
+}
+
+// Channels the client joins and posts to
+func (c *Client) Channels() []string {
+	return c.config.Channels
+}
+
+// Send posts a text to all channels and waits until it is written
+func (c *Client) Send(ctx context.Context, text string) error {
+	for _, channel := range c.config.Channels {
+		if err := c.SendTo(ctx, channel, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SendTo posts a text to a channel and waits until it is written, texts
+// longer than an irc line are split into several lines
+func (c *Client) SendTo(ctx context.Context, channel string, text string) error {
+	text = strings.Join(strings.Fields(text), " ")
+
+	// the server relays the line with the prefix :nick!~user@host
+	prefix := len(":!~@ ") + len(c.config.Nick) + len(c.config.User) + maxHost
+	command := len(fmt.Sprintf("PRIVMSG %s :\r\n", channel))
+
+	for _, part := range split(text, maxLine-prefix-command) {
+		out := &outgoing{
+			line: fmt.Sprintf("PRIVMSG %s :%s", channel, part),
+			done: make(chan error, 1),
+		}
+
+		select {
+		case c.outgoing <- out:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		select {
+		case err := <-out.done:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// dial opens the tcp or tls connection
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	conn, err := dialer.DialContext(ctx, "tcp", c.config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.config.TLS {
+		return conn, nil
+	}
+
+	tlsConfig := c.config.TLSConfig
+	if tlsConfig == nil {
+		host, _, _ := net.SplitHostPort(c.config.Address)
+		tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "tls handshake")
+	}
+
+	return tlsConn, nil
+}
+
+// session runs a single connection until it breaks
+func (c *Client) session(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return errors.Wrap(err, "connect")
+	}
+	defer conn.Close()
+
+	c.log.Infof("connected to %s", c.config.Address)
+
+	done := make(chan struct{})
+	defer close(done)
+	defer atomic.StoreInt32(&c.connected, 0)
+
+	incoming := make(chan *Message)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			if message := ParseMessage(line); message != nil {
+				select {
+				case incoming <- message:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	write := func(format string, args ...interface{}) error {
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		_, err := fmt.Fprintf(conn, format+"\r\n", args...)
+		return err
+	}
+
+	nick := c.config.Nick
+	sasl := c.config.SASLUser != ""
+
+	if c.config.Password != "" {
+		if err := write("PASS %s", c.config.Password); err != nil {
+			return err
+		}
+	}
+	if sasl {
+		if err := write("CAP REQ :sasl"); err != nil {
+			return err
+		}
+	}
+	if err := write("NICK %s", nick); err != nil {
+		return err
+	}
+	if err := write("USER %s 0 * :%s", c.config.User, c.config.RealName); err != nil {
+		return err
+	}
+
+	registered := false
+	registerTimeout := time.After(c.config.RegisterTimeout)
+	limiter := newLimiter(c.config.Burst, c.config.Rate)
+
+	// only accept outgoing messages once registered, the JOINs are written
+	// before so the server handles them first
+	var outgoingQueue chan *outgoing
+
+	for {
+		select {
+		case <-ctx.Done():
+			write("QUIT :shutdown")
+			return ctx.Err()
+		case err := <-readErr:
+			return errors.Wrap(err, "read")
+		case <-registerTimeout:
+			if !registered {
+				return errors.New("registration timeout")
+			}
+		case out := <-outgoingQueue:
+			if err := limiter.Wait(ctx); err != nil {
+				out.done <- err
+				return err
+			}
+
+			err := write("%s", out.line)
+			out.done <- err
+			if err != nil {
+				return errors.Wrap(err, "write")
+			}
+		case message := <-incoming:
+			var err error
+
+			switch message.Command {
+			case "PING":
+				err = write("PONG :%s", message.Trailing())
+			case "CAP":
+				if len(message.Params) >= 2 && message.Params[1] == "ACK" && sasl {
+					err = write("AUTHENTICATE PLAIN")
+				} else if len(message.Params) >= 2 && message.Params[1] == "NAK" {
+					return errors.New("server does not support sasl")
+				}
+			case "AUTHENTICATE":
+				if message.Trailing() == "+" {
+					credentials := fmt.Sprintf("%s\x00%s\x00%s", c.config.SASLUser, c.config.SASLUser, c.config.SASLPassword)
+					err = write("AUTHENTICATE %s", base64.StdEncoding.EncodeToString([]byte(credentials)))
+				}
+			case "903":
+				err = write("CAP END")
+			case "902", "904", "905", "906":
+				return errors.Errorf("sasl authentication failed: %s", message.Trailing())
+			case "433":
+				if !registered {
+					nick += "_"
+					err = write("NICK %s", nick)
+				}
+			case "001":
+				registered = true
+				c.log.Infof("registered as %s", nick)
+
+				for _, channel := range c.config.Channels {
+					if err = write("JOIN %s", channel); err != nil {
+						break
+					}
+				}
+				outgoingQueue = c.outgoing
+				atomic.StoreInt32(&c.connected, 1)
+			case "ERROR":
+				return errors.Errorf("server error: %s", message.Trailing())
+			}
+
+			if err != nil {
+				return errors.Wrap(err, "write")
+			}
+		}
+	}
+}
+
+// split a text into parts of at most max bytes, at spaces where possible
+// and never within a utf-8 character
+func split(text string, max int) []string {
+	parts := []string{}
+
+	for len(text) > max {
+		if cut := strings.LastIndexByte(text[:max+1], ' '); cut > 0 {
+			parts = append(parts, text[:cut])
+			text = text[cut+1:]
+			continue
+		}
+
+		cut := max
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+
+	return append(parts, text)
+}
+
+// limiter is a token bucket to avoid getting kicked for flooding
+type limiter struct {
+	tokens float64
+	burst  float64
+	rate   time.Duration
+	last   time.Time
+}
+
+func newLimiter(burst int, rate time.Duration) *limiter {
+	return &limiter{
+		tokens: float64(burst),
+		burst:  float64(burst),
+		rate:   rate,
+		last:   time.Now(),
+	}
+}
+
+// Wait until a token is available and take it
+func (l *limiter) Wait(ctx context.Context) error {
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.rate)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		wait := time.Duration((1 - l.tokens) * float64(l.rate))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		l.tokens = 1
+		l.last = time.Now()
+	}
+
+	l.tokens--
+	return nil
+}
@@ -0,0 +1,249 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// fakeServer is a minimal irc server recording every received line
+type fakeServer struct {
+	listener net.Listener
+	lines    chan string
+	conns    chan net.Conn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &fakeServer{
+		listener: listener,
+		lines:    make(chan string, 100),
+		conns:    make(chan net.Conn, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.conns <- conn
+			go server.handle(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	sasl := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.lines <- line
+
+		message := ParseMessage(line)
+		switch {
+		case line == "CAP REQ :sasl":
+			sasl = true
+			fmt.Fprint(conn, ":irc.test CAP * ACK :sasl\r\n")
+		case line == "AUTHENTICATE PLAIN":
+			fmt.Fprint(conn, "AUTHENTICATE +\r\n")
+		case message.Command == "AUTHENTICATE":
+			fmt.Fprint(conn, ":irc.test 903 moc :SASL authentication successful\r\n")
+		case line == "CAP END", message.Command == "USER" && !sasl:
+			fmt.Fprint(conn, ":irc.test 001 moc :Welcome\r\n")
+			fmt.Fprint(conn, "PING :irc.test\r\n")
+		}
+	}
+}
+
+// expect waits for a line with the given prefix and skips all others
+func (s *fakeServer) expect(t *testing.T, prefix string) string {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-s.lines:
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("no line with prefix %q received", prefix)
+			return ""
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	message := ParseMessage("@time=now :nick!user@host PRIVMSG #moc :hello world\r\n")
+
+	assert.Equal(t, "nick!user@host", message.Prefix)
+	assert.Equal(t, "PRIVMSG", message.Command)
+	assert.Equal(t, []string{"#moc", "hello world"}, message.Params)
+	assert.Equal(t, "hello world", message.Trailing())
+}
+
+func TestClientSASLAndSend(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	client := NewClient(Config{
+		Address:      server.listener.Addr().String(),
+		Nick:         "moc",
+		Channels:     []string{"#moc", "#events"},
+		SASLUser:     "moc",
+		SASLPassword: "secret",
+	}, logrus.WithField("test", true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	auth := server.expect(t, "AUTHENTICATE ")
+	for auth == "AUTHENTICATE PLAIN" {
+		auth = server.expect(t, "AUTHENTICATE ")
+	}
+	credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "AUTHENTICATE "))
+	assert.Equal(t, "moc\x00moc\x00secret", string(credentials))
+
+	server.expect(t, "JOIN #moc")
+	server.expect(t, "JOIN #events")
+	server.expect(t, "PONG :irc.test")
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer sendCancel()
+	require.NoError(t, client.Send(sendCtx, "Hallo\nWelt"))
+
+	assert.Equal(t, "PRIVMSG #moc :Hallo Welt", server.expect(t, "PRIVMSG"))
+	assert.Equal(t, "PRIVMSG #events :Hallo Welt", server.expect(t, "PRIVMSG"))
+}
+
+func TestRelayRetry(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	client := NewClient(Config{
+		Address:  server.listener.Addr().String(),
+		Nick:     "moc",
+		Channels: []string{"#moc", "#events"},
+	}, logrus.WithField("test", true))
+	relay := &Relay{Client: client}
+	message := &models.Message{ID: "1", MessageRequest: models.MessageRequest{Text: "Hackspace is open"}}
+
+	// not connected yet, nothing is posted
+	failCtx, failCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer failCancel()
+	remoteID, err := relay.Deliver(failCtx, message)
+	assert.Error(t, err)
+	assert.Empty(t, remoteID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+	server.expect(t, "JOIN #events")
+
+	// the first attempt reached #moc only, the retry skips it
+	sendCtx, sendCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer sendCancel()
+	remoteID, err = relay.Resume(sendCtx, message, "#moc")
+	require.NoError(t, err)
+	assert.Equal(t, "#moc,#events", remoteID)
+
+	assert.Equal(t, "PRIVMSG #events :Hackspace is open", server.expect(t, "PRIVMSG"))
+}
+
+func TestSendLong(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	client := NewClient(Config{
+		Address:  server.listener.Addr().String(),
+		Nick:     "moc",
+		Channels: []string{"#moc"},
+	}, logrus.WithField("test", true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+	server.expect(t, "JOIN #moc")
+
+	text := strings.Repeat("Hackspace ", 60)
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer sendCancel()
+	require.NoError(t, client.Send(sendCtx, text))
+
+	first := server.expect(t, "PRIVMSG")
+	second := server.expect(t, "PRIVMSG")
+
+	// the line relayed by the server with its prefix fits into 512 bytes
+	prefix := ":moc!~moc@" + strings.Repeat("h", maxHost) + " "
+	assert.True(t, len(prefix+first+"\r\n") <= maxLine)
+	assert.Equal(t, strings.TrimSpace(text), strings.TrimPrefix(first, "PRIVMSG #moc :")+" "+strings.TrimPrefix(second, "PRIVMSG #moc :"))
+}
+
+func TestSplit(t *testing.T) {
+	assert.Equal(t, []string{"Hackspace"}, split("Hackspace", 10))
+	assert.Equal(t, []string{"Hackspace", "is open"}, split("Hackspace is open", 10))
+	assert.Equal(t, []string{"Hacksp", "ace"}, split("Hackspace", 6))
+	assert.Equal(t, []string{"Grü", "ße"}, split("Grüße", 5))
+}
+
+func TestClientReconnect(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.listener.Close()
+
+	client := NewClient(Config{
+		Address:        server.listener.Addr().String(),
+		Nick:           "moc",
+		Channels:       []string{"#moc"},
+		ReconnectDelay: 10 * time.Millisecond,
+	}, logrus.WithField("test", true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	server.expect(t, "JOIN #moc")
+
+	// drop the connection, the client has to join again
+	(<-server.conns).Close()
+	server.expect(t, "NICK moc")
+	server.expect(t, "JOIN #moc")
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer sendCancel()
+	require.NoError(t, client.Send(sendCtx, "after reconnect"))
+	assert.Equal(t, "PRIVMSG #moc :after reconnect", server.expect(t, "PRIVMSG"))
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2, 50*time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, l.Wait(ctx))
+	}
+
+	// two lines burst, two more have to wait for the rate
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+}
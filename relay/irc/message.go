@@ -0,0 +1,65 @@
+package irc
+
+import (
+	"strings"
+)
+
+// Message is a single line of the irc protocol
+type Message struct {
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// ParseMessage parses a raw line, tags are ignored
+func ParseMessage(line string) *Message {
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		line = parts[1]
+	}
+
+	message := &Message{}
+
+	if strings.HasPrefix(line, ":") {
+		parts := strings.SplitN(line[1:], " ", 2)
+		if len(parts) != 2 {
+			return nil
+		}
+		message.Prefix = parts[0]
+		line = parts[1]
+	}
+
+	var trailing *string
+	if i := strings.Index(line, " :"); i >= 0 {
+		t := line[i+2:]
+		trailing = &t
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	message.Command = strings.ToUpper(fields[0])
+	message.Params = fields[1:]
+	if trailing != nil {
+		message.Params = append(message.Params, *trailing)
+	}
+
+	return message
+}
+
+// Trailing returns the last parameter
+func (m *Message) Trailing() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+
+	return m.Params[len(m.Params)-1]
+}
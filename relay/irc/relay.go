@@ -0,0 +1,102 @@
+package irc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+)
+
+func init() {
+	relay.Register("irc", open)
+}
+
+// Relay posts messages to irc channels
+type Relay struct {
+	Client *Client
+}
+
+// open connects to the configured irc server
+func open(ctx context.Context, cfg *config.Config, db *gorm.DB) (relay.Relay, error) {
+	if cfg.IRC.Address == "" || cfg.IRC.Nick == "" || cfg.IRC.Channel == "" {
+		return nil, errors.New("need IRC_ADDRESS, IRC_NICK and IRC_CHANNEL env vars")
+	}
+
+	client := NewClient(Config{
+		Address:      cfg.IRC.Address,
+		TLS:          cfg.IRC.TLS,
+		Nick:         cfg.IRC.Nick,
+		User:         cfg.IRC.User,
+		RealName:     cfg.IRC.FullName,
+		Password:     cfg.IRC.Password,
+		Channels:     config.List(cfg.IRC.Channel),
+		SASLUser:     cfg.IRC.SASLUser,
+		SASLPassword: cfg.IRC.SASLPassword,
+	}, logrus.WithField("relay", "irc"))
+	go client.Run(ctx)
+
+	return &Relay{Client: client}, nil
+}
+
+// Name of the relay
+func (r *Relay) Name() string {
+	return "irc"
+}
+
+// Deliver posts the message to all channels and returns them comma
+// separated as remote id
+func (r *Relay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	return r.Resume(ctx, message, "")
+}
+
+// Resume posts the message to the channels missing in the remote id of a
+// failed attempt, so a retry does not post twice
+func (r *Relay) Resume(ctx context.Context, message *models.Message, remoteID string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	sent := config.List(remoteID)
+	for _, channel := range r.Client.Channels() {
+		if contains(sent, channel) {
+			continue
+		}
+
+		if err := r.Client.SendTo(ctx, channel, message.Text); err != nil {
+			return strings.Join(sent, ","), errors.Wrap(err, channel)
+		}
+		sent = append(sent, channel)
+	}
+
+	return strings.Join(sent, ","), nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Retract is not possible on irc
+func (r *Relay) Retract(ctx context.Context, message *models.Message, remoteID string) error {
+	return relay.ErrNotSupported
+}
+
+// Health checks the connection
+func (r *Relay) Health(ctx context.Context) error {
+	if !r.Client.Connected() {
+		return errors.New("not connected")
+	}
+
+	return nil
+}
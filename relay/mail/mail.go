@@ -0,0 +1,274 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+)
+
+func init() {
+	relay.Register("mail", open)
+}
+
+// DefaultSubjectTemplate of message mails
+const DefaultSubjectTemplate = `New message`
+
+// DefaultBodyTemplate of message mails
+const DefaultBodyTemplate = `{{ .Message.Text }}
+
+--
+Unsubscribe: {{ .UnsubscribeURL }}
+`
+
+// healthTTL of a checked smtp connection, so status requests don't connect
+// to the server every time
+const healthTTL = time.Minute
+
+const confirmSubject = `Please confirm your subscription`
+
+const confirmBody = `Hello,
+
+please confirm your subscription by opening the following link:
+
+{{ .ConfirmURL }}
+
+If you did not subscribe, just ignore this mail.
+`
+
+// Data available in the templates
+type Data struct {
+	Message        *models.Message
+	Subscriber     *models.Subscriber
+	ConfirmURL     string
+	UnsubscribeURL string
+}
+
+// Relay sends every message to all confirmed subscribers
+type Relay struct {
+	Mailer  *Mailer
+	BaseURL string
+
+	subject        *template.Template
+	body           *template.Template
+	confirmSubject *template.Template
+	confirmBody    *template.Template
+
+	healthMu  sync.Mutex
+	checkedAt time.Time
+	healthErr error
+
+	db  *gorm.DB
+	log *logrus.Entry
+}
+
+// NewRelay parses the templates and creates a mail relay
+func NewRelay(db *gorm.DB, mailer *Mailer, baseURL string, subject string, body string) (*Relay, error) {
+	if subject == "" {
+		subject = DefaultSubjectTemplate
+	}
+	if body == "" {
+		body = DefaultBodyTemplate
+	}
+
+	relay := &Relay{
+		Mailer:  mailer,
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		db:      db,
+		log:     logrus.WithField("relay", "mail"),
+	}
+
+	var err error
+	if relay.subject, err = template.New("subject").Parse(subject); err != nil {
+		return nil, errors.Wrap(err, "bad subject template")
+	}
+	if relay.body, err = template.New("body").Parse(body); err != nil {
+		return nil, errors.Wrap(err, "bad body template")
+	}
+	relay.confirmSubject = template.Must(template.New("confirmSubject").Parse(confirmSubject))
+	relay.confirmBody = template.Must(template.New("confirmBody").Parse(confirmBody))
+
+	return relay, nil
+}
+
+// open the relay with the configured smtp server and send confirmations in
+// the background
+func open(ctx context.Context, cfg *config.Config, db *gorm.DB) (relay.Relay, error) {
+	if cfg.Mail.Host == "" || cfg.Mail.From == "" || cfg.Mail.BaseURL == "" {
+		return nil, errors.New("need SMTP_HOST, MAIL_FROM and MAIL_BASE_URL env vars")
+	}
+
+	port := cfg.Mail.Port
+	if port == 0 {
+		port = 587
+	}
+
+	mailer := &Mailer{
+		Host:     cfg.Mail.Host,
+		Port:     port,
+		Username: cfg.Mail.Username,
+		Password: cfg.Mail.Password,
+		Security: cfg.Mail.Security,
+		From:     cfg.Mail.From,
+	}
+
+	mailRelay, err := NewRelay(db, mailer, cfg.Mail.BaseURL, cfg.Mail.SubjectTemplate, cfg.Mail.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := relay.DefaultInterval
+	if cfg.Relay.PollInterval > 0 {
+		interval = time.Duration(cfg.Relay.PollInterval) * time.Second
+	}
+	go mailRelay.Run(ctx, interval)
+
+	return mailRelay, nil
+}
+
+// Name of the relay
+func (r *Relay) Name() string {
+	return "mail"
+}
+
+// Retract is not possible for sent mails
+func (r *Relay) Retract(ctx context.Context, message *models.Message, remoteID string) error {
+	return relay.ErrNotSupported
+}
+
+// Health checks the connection to the smtp server, the result is reused for
+// a minute
+func (r *Relay) Health(ctx context.Context) error {
+	r.healthMu.Lock()
+	defer r.healthMu.Unlock()
+
+	if time.Since(r.checkedAt) >= healthTTL {
+		r.healthErr = r.Mailer.Check()
+		r.checkedAt = time.Now()
+	}
+
+	return r.healthErr
+}
+
+// Deliver sends a message to every confirmed subscriber and returns the
+// number of reached subscribers, it only fails if no subscriber could be
+// reached to avoid duplicates on retries
+func (r *Relay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	var subscribers []*models.Subscriber
+	if res := r.db.Where("confirmed_at IS NOT NULL").Find(&subscribers); res.Error != nil {
+		return "", errors.Wrap(res.Error, "load subscribers")
+	}
+
+	var lastErr error
+	failed := 0
+	for _, subscriber := range subscribers {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		data := r.data(subscriber)
+		data.Message = message
+
+		if err := r.send(subscriber, r.subject, r.body, data); err != nil {
+			r.log.WithError(err).WithField("subscriber", subscriber.ID).Warn("send mail failed")
+			lastErr = err
+			failed++
+		}
+	}
+
+	if failed > 0 && failed == len(subscribers) {
+		return "", errors.Wrapf(lastErr, "all %d mails failed", failed)
+	}
+
+	return fmt.Sprintf("%d/%d", len(subscribers)-failed, len(subscribers)), nil
+}
+
+// SendConfirmations mails the confirmation link to all new subscribers
+func (r *Relay) SendConfirmations(ctx context.Context) error {
+	var subscribers []*models.Subscriber
+	if res := r.db.Where("confirmed_at IS NULL AND confirmation_sent_at IS NULL").Find(&subscribers); res.Error != nil {
+		return errors.Wrap(res.Error, "load new subscribers")
+	}
+
+	for _, subscriber := range subscribers {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := r.send(subscriber, r.confirmSubject, r.confirmBody, r.data(subscriber)); err != nil {
+			r.log.WithError(err).WithField("subscriber", subscriber.ID).Warn("send confirmation failed")
+			continue
+		}
+
+		now := time.Now()
+		subscriber.ConfirmationSentAt = &now
+		if res := r.db.Save(subscriber); res.Error != nil {
+			return errors.Wrap(res.Error, "save subscriber")
+		}
+	}
+
+	return nil
+}
+
+// Run sends confirmations in the interval until the context is canceled
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.SendConfirmations(ctx); err != nil {
+			r.log.WithError(err).Error("send confirmations failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// data with the links of a subscriber
+func (r *Relay) data(subscriber *models.Subscriber) *Data {
+	token := url.QueryEscape(subscriber.Token)
+
+	return &Data{
+		Subscriber:     subscriber,
+		ConfirmURL:     fmt.Sprintf("%s/subscribers/confirm?token=%s", r.BaseURL, token),
+		UnsubscribeURL: fmt.Sprintf("%s/subscribers/unsubscribe?token=%s", r.BaseURL, token),
+	}
+}
+
+// send renders the templates and mails them to the subscriber
+func (r *Relay) send(subscriber *models.Subscriber, subject *template.Template, body *template.Template, data *Data) error {
+	var subjectBuf, bodyBuf bytes.Buffer
+
+	if err := subject.Execute(&subjectBuf, data); err != nil {
+		return errors.Wrap(err, "render subject")
+	}
+	if err := body.Execute(&bodyBuf, data); err != nil {
+		return errors.Wrap(err, "render body")
+	}
+
+	return r.Mailer.Send(&Mail{
+		To:      subscriber.Email,
+		Subject: strings.Join(strings.Fields(subjectBuf.String()), " "),
+		Body:    bodyBuf.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", data.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
@@ -0,0 +1,198 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// sentMail received by the smtp sink
+type sentMail struct {
+	Auth string
+	To   string
+	Data string
+}
+
+// newSMTPSink starts a plain text smtp server collecting all mails
+func newSMTPSink(t *testing.T) (net.Listener, chan *sentMail) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	mails := make(chan *sentMail, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+				sent := &sentMail{}
+
+				reply("220 sink ESMTP")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimRight(line, "\r\n")
+
+					switch {
+					case strings.HasPrefix(line, "EHLO"):
+						reply("250-sink")
+						reply("250 AUTH PLAIN")
+					case strings.HasPrefix(line, "AUTH PLAIN"):
+						sent.Auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+						reply("235 ok")
+					case strings.HasPrefix(line, "MAIL FROM"):
+						reply("250 ok")
+					case strings.HasPrefix(line, "RCPT TO"):
+						sent.To = line
+						reply("250 ok")
+					case line == "DATA":
+						reply("354 go ahead")
+
+						var data []string
+						for {
+							line, err := reader.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							data = append(data, line)
+						}
+						sent.Data = strings.Join(data, "")
+
+						mails <- sent
+						reply("250 queued")
+					case line == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return listener, mails
+}
+
+func receive(t *testing.T, mails chan *sentMail) (*sentMail, *mail.Message, string) {
+	select {
+	case sent := <-mails:
+		message, err := mail.ReadMessage(strings.NewReader(sent.Data))
+		require.NoError(t, err)
+
+		body, err := ioutil.ReadAll(quotedprintable.NewReader(message.Body))
+		require.NoError(t, err)
+
+		return sent, message, string(body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+		return nil, nil, ""
+	}
+}
+
+func TestRelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moc-mail")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	db.AutoMigrate(models.All()...)
+
+	listener, mails := newSMTPSink(t)
+	defer listener.Close()
+
+	mailer := &Mailer{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		Username: "moc",
+		Password: "secret",
+		Security: SecurityNone,
+		From:     "MOC <moc@example.com>",
+	}
+
+	relay, err := NewRelay(db, mailer, "https://moc.example.com/", "Neu: {{ .Message.Text }}", "")
+	require.NoError(t, err)
+
+	subscriber := models.NewSubscriber("alice@example.com")
+	db.Create(subscriber)
+
+	// new subscribers get the confirmation link once
+	require.NoError(t, relay.SendConfirmations(context.Background()))
+	require.NoError(t, relay.SendConfirmations(context.Background()))
+
+	sent, message, body := receive(t, mails)
+	assert.Equal(t, "RCPT TO:<alice@example.com>", sent.To)
+	assert.NotEmpty(t, sent.Auth)
+	assert.Equal(t, confirmSubject, message.Header.Get("Subject"))
+	assert.Contains(t, body, "https://moc.example.com/subscribers/confirm?token="+subscriber.Token)
+	assert.Len(t, mails, 0)
+
+	// messages are only sent to confirmed subscribers
+	now := time.Now()
+	db.Model(subscriber).Update("confirmed_at", &now)
+	db.Create(models.NewSubscriber("bob@example.com"))
+
+	remoteID, err := relay.Deliver(context.Background(), models.NewMessage("Hackspace öffnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "1/1", remoteID)
+
+	sent, message, body = receive(t, mails)
+	assert.Equal(t, "RCPT TO:<alice@example.com>", sent.To)
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	assert.Equal(t, "Neu: Hackspace öffnet", subject)
+	assert.Equal(t, "<https://moc.example.com/subscribers/unsubscribe?token="+subscriber.Token+">", message.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", message.Header.Get("List-Unsubscribe-Post"))
+	assert.True(t, strings.HasPrefix(body, "Hackspace öffnet\r\n"))
+}
+
+func TestHealthCached(t *testing.T) {
+	listener, _ := newSMTPSink(t)
+
+	mailRelay, err := NewRelay(nil, &Mailer{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		Security: SecurityNone,
+	}, "https://moc.example.com", "", "")
+	require.NoError(t, err)
+
+	require.NoError(t, mailRelay.Health(context.Background()))
+
+	// the server is gone, the last check is reused
+	listener.Close()
+	assert.NoError(t, mailRelay.Health(context.Background()))
+
+	mailRelay.checkedAt = time.Time{}
+	assert.Error(t, mailRelay.Health(context.Background()))
+}
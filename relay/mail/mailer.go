@@ -0,0 +1,198 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Security modes of the smtp connection
+const (
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+	SecurityNone     = "none"
+)
+
+// Mailer sends mails over smtp
+type Mailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string
+	From     string
+
+	// TLSConfig overrides the default tls configuration
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+}
+
+// Mail is a plain text mail to a single recipient
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+	Headers map[string]string
+}
+
+// Send delivers a mail
+func (m *Mailer) Send(message *Mail) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return errors.Wrap(err, "bad sender address")
+	}
+
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return errors.Wrap(err, "bad recipient address")
+	}
+
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return errors.Wrap(err, "smtp auth")
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return errors.Wrap(err, "smtp mail from")
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return errors.Wrap(err, "smtp rcpt to")
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "smtp data")
+	}
+	if _, err := w.Write(m.compose(from, to, message)); err != nil {
+		return errors.Wrap(err, "smtp write")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "smtp data")
+	}
+
+	return client.Quit()
+}
+
+// Check connects to the server and logs in without sending a mail
+func (m *Mailer) Check() error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return errors.Wrap(err, "smtp auth")
+		}
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the server and upgrades the connection to tls
+func (m *Mailer) dial() (*smtp.Client, error) {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	tlsConfig := m.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: m.Host}
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	if m.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "smtp connect")
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "smtp handshake")
+	}
+
+	if m.Security == "" || m.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, errors.Wrap(err, "smtp starttls")
+		}
+	}
+
+	return client, nil
+}
+
+// compose the raw mail with headers and a quoted printable body
+func (m *Mailer) compose(from *mail.Address, to *mail.Address, message *Mail) []byte {
+	domain := "localhost"
+	if i := strings.LastIndex(from.Address, "@"); i >= 0 {
+		domain = from.Address[i+1:]
+	}
+
+	headers := map[string]string{
+		"From":                      from.String(),
+		"To":                        to.String(),
+		"Subject":                   mime.QEncoding.Encode("utf-8", message.Subject),
+		"Date":                      time.Now().Format(time.RFC1123Z),
+		"Message-ID":                fmt.Sprintf("<%s@%s>", uuid.New().String(), domain),
+		"MIME-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, headers[key])
+	}
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.Replace(message.Body, "\n", "\r\n", -1)))
+	qp.Close()
+
+	return buf.Bytes()
+}
@@ -0,0 +1,206 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// maxResponseSize of homeserver responses
+const maxResponseSize = 1 << 20
+
+// Error returned by the homeserver
+type Error struct {
+	Status       int    `json:"-"`
+	Code         string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMs int    `json:"retry_after_ms,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Client talks to a homeserver with the client-server api
+type Client struct {
+	Homeserver  string
+	AccessToken string
+
+	// MaxRetries on rate limits and server errors
+	MaxRetries int
+	// Backoff is the first delay between retries, it doubles every retry
+	Backoff time.Duration
+
+	http *http.Client
+	log  *logrus.Entry
+}
+
+// NewClient for a homeserver like https://matrix.org
+func NewClient(homeserver string, log *logrus.Entry) *Client {
+	return &Client{
+		Homeserver: strings.TrimSuffix(homeserver, "/"),
+		MaxRetries: 5,
+		Backoff:    time.Second,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		log:        log,
+	}
+}
+
+// Login with user and password and keep the access token
+func (c *Client) Login(ctx context.Context, user string, password string) error {
+	request := map[string]interface{}{
+		"type": "m.login.password",
+		"identifier": map[string]string{
+			"type": "m.id.user",
+			"user": user,
+		},
+		"password":                    password,
+		"initial_device_display_name": "moc",
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/login", request, &response); err != nil {
+		return errors.Wrap(err, "login")
+	}
+
+	c.AccessToken = response.AccessToken
+	return nil
+}
+
+// WhoAmI checks the access token
+func (c *Client) WhoAmI(ctx context.Context) error {
+	return c.request(ctx, http.MethodGet, "/account/whoami", nil, nil)
+}
+
+// JoinRoom by id or alias and return the room id
+func (c *Client) JoinRoom(ctx context.Context, room string) (string, error) {
+	var response struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/join/"+url.PathEscape(room), map[string]string{}, &response); err != nil {
+		return "", errors.Wrapf(err, "join %s", room)
+	}
+
+	return response.RoomID, nil
+}
+
+// SendNotice posts a m.notice to a room and returns the event id, the
+// transaction id makes retries idempotent
+func (c *Client) SendNotice(ctx context.Context, roomID string, txnID string, text string) (string, error) {
+	request := map[string]string{
+		"msgtype": "m.notice",
+		"body":    text,
+	}
+
+	var response struct {
+		EventID string `json:"event_id"`
+	}
+	path := fmt.Sprintf("/rooms/%s/send/m.room.message/%s", url.PathEscape(roomID), url.PathEscape(txnID))
+	if err := c.do(ctx, http.MethodPut, path, request, &response); err != nil {
+		return "", errors.Wrapf(err, "send to %s", roomID)
+	}
+
+	return response.EventID, nil
+}
+
+// Redact an event of a room
+func (c *Client) Redact(ctx context.Context, roomID string, eventID string, txnID string, reason string) error {
+	request := map[string]string{
+		"reason": reason,
+	}
+
+	path := fmt.Sprintf("/rooms/%s/redact/%s/%s", url.PathEscape(roomID), url.PathEscape(eventID), url.PathEscape(txnID))
+	if err := c.do(ctx, http.MethodPut, path, request, nil); err != nil {
+		return errors.Wrapf(err, "redact %s in %s", eventID, roomID)
+	}
+
+	return nil
+}
+
+// do a request and retry on rate limits and server errors
+func (c *Client) do(ctx context.Context, method string, path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	delay := c.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.request(ctx, method, path, body, response)
+
+		matrixErr, ok := err.(*Error)
+		if !ok || attempt >= c.MaxRetries {
+			return err
+		}
+		if matrixErr.Status != http.StatusTooManyRequests && matrixErr.Status < http.StatusInternalServerError {
+			return err
+		}
+
+		wait := delay
+		if matrixErr.RetryAfterMs > 0 {
+			wait = time.Duration(matrixErr.RetryAfterMs) * time.Millisecond
+		}
+		c.log.WithError(err).Warnf("retry in %s", wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+	}
+}
+
+// request sends a single request
+func (c *Client) request(ctx context.Context, method string, path string, body []byte, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.Homeserver+"/_matrix/client/v3"+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		matrixErr := &Error{Status: res.StatusCode}
+		json.Unmarshal(data, matrixErr)
+		return matrixErr
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, response)
+}
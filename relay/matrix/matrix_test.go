@@ -0,0 +1,101 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// fakeHomeserver records sent and redacted events
+type fakeHomeserver struct {
+	sync.Mutex
+
+	sent      map[string]string
+	redacted  []string
+	rateLimit int
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/_matrix/client/v3")
+
+	if path != "/login" && r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(Error{Code: "M_UNKNOWN_TOKEN", Message: "bad token"})
+		return
+	}
+
+	switch {
+	case path == "/login":
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+	case strings.HasPrefix(path, "/join/"):
+		json.NewEncoder(w).Encode(map[string]string{"room_id": "!room:test"})
+	case strings.Contains(path, "/send/m.room.message/"):
+		if f.rateLimit > 0 {
+			f.rateLimit--
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(Error{Code: "M_LIMIT_EXCEEDED", Message: "slow down", RetryAfterMs: 10})
+			return
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		txnID := path[strings.LastIndex(path, "/")+1:]
+		f.sent[txnID] = body["msgtype"] + ":" + body["body"]
+		json.NewEncoder(w).Encode(map[string]string{"event_id": "$" + txnID})
+	case strings.Contains(path, "/redact/"):
+		parts := strings.Split(path, "/")
+		f.redacted = append(f.redacted, parts[4])
+		json.NewEncoder(w).Encode(map[string]string{"event_id": "$redaction"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	homeserver := &fakeHomeserver{sent: map[string]string{}, rateLimit: 2}
+	server := httptest.NewServer(homeserver)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client := NewClient(server.URL, logrus.WithField("test", true))
+	client.Backoff = time.Millisecond
+	require.NoError(t, client.Login(ctx, "moc", "secret"))
+
+	relay, err := NewRelay(ctx, client, []string{"#moc:test"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"!room:test"}, relay.RoomIDs)
+
+	message := models.NewMessage("Hackspace is open")
+	message.ID = "1"
+
+	// rate limited requests are retried
+	remoteID, err := relay.Deliver(ctx, message)
+	require.NoError(t, err)
+	assert.Equal(t, `{"!room:test":"$moc-1"}`, remoteID)
+	assert.Equal(t, map[string]string{"moc-1": "m.notice:Hackspace is open"}, homeserver.sent)
+
+	require.NoError(t, relay.Retract(ctx, message, remoteID))
+	assert.Equal(t, []string{"$moc-1"}, homeserver.redacted)
+
+	// give up after max retries
+	homeserver.rateLimit = 10
+	client.MaxRetries = 2
+	_, err = relay.Deliver(ctx, message)
+	assert.Error(t, err)
+}
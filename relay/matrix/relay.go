@@ -0,0 +1,111 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+)
+
+func init() {
+	relay.Register("matrix", open)
+}
+
+// Relay posts messages as notices to rooms and redacts them on deletion
+type Relay struct {
+	Client *Client
+
+	// RoomIDs of the joined rooms
+	RoomIDs []string
+}
+
+// open logs in to the configured homeserver and joins the rooms
+func open(ctx context.Context, cfg *config.Config, db *gorm.DB) (relay.Relay, error) {
+	if cfg.Matrix.Homeserver == "" || cfg.Matrix.Rooms == "" {
+		return nil, errors.New("need MATRIX_HOMESERVER and MATRIX_ROOMS env vars")
+	}
+
+	if cfg.Matrix.AccessToken == "" && (cfg.Matrix.User == "" || cfg.Matrix.Password == "") {
+		return nil, errors.New("need MATRIX_ACCESS_TOKEN or MATRIX_USER and MATRIX_PASSWORD env vars")
+	}
+
+	client := NewClient(cfg.Matrix.Homeserver, logrus.WithField("relay", "matrix"))
+	client.AccessToken = cfg.Matrix.AccessToken
+
+	if client.AccessToken == "" {
+		if err := client.Login(ctx, cfg.Matrix.User, cfg.Matrix.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewRelay(ctx, client, config.List(cfg.Matrix.Rooms))
+}
+
+// NewRelay joins all rooms
+func NewRelay(ctx context.Context, client *Client, rooms []string) (*Relay, error) {
+	relay := &Relay{Client: client}
+
+	for _, room := range rooms {
+		roomID, err := client.JoinRoom(ctx, room)
+		if err != nil {
+			return nil, err
+		}
+
+		relay.RoomIDs = append(relay.RoomIDs, roomID)
+	}
+
+	return relay, nil
+}
+
+// Name of the relay
+func (r *Relay) Name() string {
+	return "matrix"
+}
+
+// Health checks if the access token is still valid
+func (r *Relay) Health(ctx context.Context) error {
+	return r.Client.WhoAmI(ctx)
+}
+
+// Deliver posts the message to all rooms and returns the event ids per room
+func (r *Relay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	events := map[string]string{}
+
+	for _, roomID := range r.RoomIDs {
+		eventID, err := r.Client.SendNotice(ctx, roomID, "moc-"+message.ID, message.Text)
+		if err != nil {
+			return "", err
+		}
+
+		events[roomID] = eventID
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Retract redacts the posted events of a deleted message
+func (r *Relay) Retract(ctx context.Context, message *models.Message, remoteID string) error {
+	events := map[string]string{}
+	if err := json.Unmarshal([]byte(remoteID), &events); err != nil {
+		return errors.Wrap(err, "bad remote id")
+	}
+
+	for roomID, eventID := range events {
+		if err := r.Client.Redact(ctx, roomID, eventID, "moc-redact-"+message.ID, "message deleted"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
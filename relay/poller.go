@@ -0,0 +1,375 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// DefaultInterval between two database polls
+const DefaultInterval = 5 * time.Second
+
+// DefaultMaxAttempts until a failed delivery or retraction is given up
+const DefaultMaxAttempts = 5
+
+// DefaultQueueSize of events waiting for a relay
+const DefaultQueueSize = 100
+
+// Status of a relay
+type Status struct {
+	Name          string     `json:"name"`
+	Healthy       bool       `json:"healthy"`
+	Error         string     `json:"error,omitempty"`
+	Queued        int        `json:"queued"`
+	Delivered     int        `json:"delivered"`
+	Failed        int        `json:"failed"`
+	LastDelivered *time.Time `json:"last_delivered,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// Poller feeds a relay with new, updated and deleted messages. Events are
+// handled as soon as they are queued, the database is polled in the interval
+// to retry failed deliveries and catch up messages missed while the relay
+// was down. Every attempt is recorded as delivery, so the status is visible
+// to the api and nothing is posted twice after a restart.
+type Poller struct {
+	Relay       Relay
+	Interval    time.Duration
+	MaxAttempts int
+
+	// Since skips all messages created before, it defaults to the first
+	// message ever relayed or the start of the poller
+	Since time.Time
+
+	queue    chan Event
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu     sync.Mutex
+	status Status
+
+	db  *gorm.DB
+	log *logrus.Entry
+}
+
+// NewPoller creates a poller for a relay
+func NewPoller(db *gorm.DB, relay Relay) *Poller {
+	return &Poller{
+		Relay:       relay,
+		Interval:    DefaultInterval,
+		MaxAttempts: DefaultMaxAttempts,
+		queue:       make(chan Event, DefaultQueueSize),
+		stop:        make(chan struct{}),
+		status:      Status{Name: relay.Name()},
+		db:          db,
+		log:         logrus.WithField("relay", relay.Name()),
+	}
+}
+
+// Name of the relay
+func (p *Poller) Name() string {
+	return p.Relay.Name()
+}
+
+// Notify queues an event without blocking, events which don't fit into the
+// queue are picked up by the next poll
+func (p *Poller) Notify(event Event) bool {
+	select {
+	case p.queue <- event:
+		return true
+	default:
+		p.log.WithField("message", event.Message.ID).Warn("queue full, wait for next poll")
+		return false
+	}
+}
+
+// Status of the relay including a health check
+func (p *Poller) Status(ctx context.Context) Status {
+	err := p.Relay.Health(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := p.status
+	status.Queued = len(p.queue)
+	status.Healthy = err == nil
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// Stop lets Run return once the queued events are handled
+func (p *Poller) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+}
+
+// Run handles events and polls until the context is canceled or the poller
+// is stopped
+func (p *Poller) Run(ctx context.Context) error {
+	if p.Since.IsZero() {
+		since, err := p.firstRelayed()
+		if err != nil {
+			return err
+		}
+		p.Since = since
+	}
+
+	p.log.Infof("Relay messages since %s", p.Since.Format(time.RFC3339))
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	if err := p.Poll(ctx); err != nil {
+		p.log.WithError(err).Error("poll failed")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.stop:
+			p.flush(ctx)
+			return nil
+		case event := <-p.queue:
+			if err := p.Handle(ctx, event); err != nil {
+				p.log.WithError(err).Error("handle event failed")
+			}
+		case <-ticker.C:
+			if err := p.Poll(ctx); err != nil {
+				p.log.WithError(err).Error("poll failed")
+			}
+		}
+	}
+}
+
+// flush handles the queued events until the queue is empty or the context
+// is canceled
+func (p *Poller) flush(ctx context.Context) {
+	for ctx.Err() == nil {
+		select {
+		case event := <-p.queue:
+			if err := p.Handle(ctx, event); err != nil {
+				p.log.WithError(err).Error("handle event failed")
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Handle a single event
+func (p *Poller) Handle(ctx context.Context, event Event) error {
+	delivery := models.Delivery{}
+	res := p.db.Where(models.Delivery{Relay: p.Name(), MessageID: event.Message.ID}).FirstOrInit(&delivery)
+	if res.Error != nil {
+		return errors.Wrap(res.Error, "load delivery")
+	}
+
+	switch event.Type {
+	case EventCreated:
+		if delivery.Status == models.DeliveryFailed && delivery.Attempts < p.MaxAttempts || delivery.Status == "" {
+			return p.deliver(ctx, event.Message, &delivery)
+		}
+	case EventUpdated:
+		if delivery.Status == models.DeliveryDelivered {
+			return p.update(ctx, event.Message, &delivery)
+		}
+	case EventDeleted:
+		if delivery.Status == models.DeliveryDelivered {
+			return p.retract(ctx, event.Message, &delivery)
+		}
+	}
+
+	return nil
+}
+
+// Poll delivers all pending messages and retracts deleted ones once
+func (p *Poller) Poll(ctx context.Context) error {
+	var messages []*models.Message
+	res := p.db.
+		Where("created_at >= ?", p.Since).
+		Where("id NOT IN ?", p.db.Model(&models.Delivery{}).Select("message_id").Where("relay = ? AND (status <> ? OR attempts >= ?)", p.Name(), models.DeliveryFailed, p.MaxAttempts).SubQuery()).
+		Order("created_at").
+		Find(&messages)
+	if res.Error != nil {
+		return errors.Wrap(res.Error, "load pending messages")
+	}
+
+	for _, message := range messages {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := p.Handle(ctx, Event{Type: EventCreated, Message: message}); err != nil {
+			return err
+		}
+	}
+
+	var deleted []*models.Message
+	res = p.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Where("id IN ?", p.db.Model(&models.Delivery{}).Select("message_id").Where("relay = ? AND status = ?", p.Name(), models.DeliveryDelivered).SubQuery()).
+		Find(&deleted)
+	if res.Error != nil {
+		return errors.Wrap(res.Error, "load deleted messages")
+	}
+
+	for _, message := range deleted {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if err := p.Handle(ctx, Event{Type: EventDeleted, Message: message}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver a single message and record the result
+func (p *Poller) deliver(ctx context.Context, message *models.Message, delivery *models.Delivery) error {
+	log := p.log.WithField("message", message.ID)
+
+	var remoteID string
+	var err error
+	if resumer, ok := p.Relay.(Resumer); ok && delivery.RemoteID != "" {
+		remoteID, err = resumer.Resume(ctx, message, delivery.RemoteID)
+	} else {
+		remoteID, err = p.Relay.Deliver(ctx, message)
+	}
+
+	delivery.Attempts++
+	if err != nil {
+		log.WithError(err).Warnf("delivery failed (attempt %d/%d)", delivery.Attempts, p.MaxAttempts)
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+		if _, ok := p.Relay.(Resumer); ok {
+			delivery.RemoteID = remoteID
+		}
+	} else {
+		log.Info("message delivered")
+		delivery.Status = models.DeliveryDelivered
+		delivery.RemoteID = remoteID
+		delivery.Error = ""
+	}
+	p.record(err)
+
+	if res := p.db.Save(delivery); res.Error != nil {
+		return errors.Wrap(res.Error, "save delivery")
+	}
+
+	return nil
+}
+
+// update the posted copy of a changed message and record the result
+func (p *Poller) update(ctx context.Context, message *models.Message, delivery *models.Delivery) error {
+	updater, ok := p.Relay.(Updater)
+	if !ok {
+		return nil
+	}
+
+	log := p.log.WithField("message", message.ID)
+
+	remoteID, err := updater.Update(ctx, message, delivery.RemoteID)
+	if err == ErrNotSupported {
+		return nil
+	}
+
+	if err != nil {
+		log.WithError(err).Warn("update failed")
+		delivery.Error = err.Error()
+	} else {
+		log.Info("message updated")
+		delivery.RemoteID = remoteID
+		delivery.Error = ""
+	}
+	p.record(err)
+
+	if res := p.db.Save(delivery); res.Error != nil {
+		return errors.Wrap(res.Error, "save delivery")
+	}
+
+	return nil
+}
+
+// retract a deleted message and record the result
+func (p *Poller) retract(ctx context.Context, message *models.Message, delivery *models.Delivery) error {
+	log := p.log.WithField("message", message.ID)
+
+	err := p.Relay.Retract(ctx, message, delivery.RemoteID)
+	switch {
+	case err == ErrNotSupported:
+		delivery.Status = models.DeliveryKept
+		err = nil
+	case err != nil:
+		delivery.RetractAttempts++
+		log.WithError(err).Warnf("retraction failed (attempt %d/%d)", delivery.RetractAttempts, p.MaxAttempts)
+		delivery.Error = err.Error()
+		if delivery.RetractAttempts >= p.MaxAttempts {
+			delivery.Status = models.DeliveryKept
+		}
+	default:
+		log.Info("message retracted")
+		delivery.Status = models.DeliveryRetracted
+		delivery.Error = ""
+	}
+	p.record(err)
+
+	if res := p.db.Save(delivery); res.Error != nil {
+		return errors.Wrap(res.Error, "save delivery")
+	}
+
+	return nil
+}
+
+// record the result of an attempt for the status
+func (p *Poller) record(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.status.Failed++
+		p.status.LastError = err.Error()
+		return
+	}
+
+	now := time.Now()
+	p.status.Delivered++
+	p.status.LastDelivered = &now
+}
+
+// firstRelayed returns the creation time of the first message handed to the
+// relay, so messages missed while the relay was down are caught up without
+// flooding a new relay with the whole history
+func (p *Poller) firstRelayed() (time.Time, error) {
+	delivery := models.Delivery{}
+	res := p.db.Where(models.Delivery{Relay: p.Name()}).Order("created_at").First(&delivery)
+	if gorm.IsRecordNotFoundError(res.Error) {
+		return time.Now(), nil
+	}
+	if res.Error != nil {
+		return time.Time{}, errors.Wrap(res.Error, "load first delivery")
+	}
+
+	message := models.Message{}
+	res = p.db.Unscoped().First(&message, models.Message{ID: delivery.MessageID})
+	if gorm.IsRecordNotFoundError(res.Error) {
+		return delivery.CreatedAt, nil
+	}
+	if res.Error != nil {
+		return time.Time{}, errors.Wrap(res.Error, "load first message")
+	}
+
+	return message.CreatedAt, nil
+}
@@ -0,0 +1,327 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/models/modelstest"
+)
+
+// waitForStatus of the test delivery of a message
+func waitForStatus(t *testing.T, db *gorm.DB, message *models.Message, status string) {
+	for i := 0; i < 100; i++ {
+		delivery := models.Delivery{}
+		db.Where(models.Delivery{Relay: "test", MessageID: message.ID}).First(&delivery)
+		if delivery.Status == status {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivery of %s is not %s", message.ID, status)
+}
+
+// fakeRelay records all calls
+type fakeRelay struct {
+	name      string
+	fail      bool
+	hang      bool
+	unretract bool
+	delivered []string
+	retracted []string
+}
+
+func (f *fakeRelay) Name() string {
+	return f.name
+}
+
+func (f *fakeRelay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	if f.fail {
+		return "", errors.New("relay down")
+	}
+	if f.hang {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	f.delivered = append(f.delivered, message.Text)
+	return "remote-" + message.ID, nil
+}
+
+func (f *fakeRelay) Retract(ctx context.Context, message *models.Message, remoteID string) error {
+	if f.retracted == nil {
+		return ErrNotSupported
+	}
+	if f.unretract {
+		return errors.New("relay down")
+	}
+	f.retracted = append(f.retracted, remoteID)
+	return nil
+}
+
+func (f *fakeRelay) Health(ctx context.Context) error {
+	if f.fail {
+		return errors.New("relay down")
+	}
+	return nil
+}
+
+func TestPoller(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	models.Seed(db)
+	time.Sleep(10 * time.Millisecond)
+
+	relay := &fakeRelay{name: "test", retracted: []string{}}
+
+	poller := NewPoller(db, relay)
+	poller.MaxAttempts = 2
+	poller.Since = time.Now()
+
+	ctx := context.Background()
+
+	// messages before the start are not relayed
+	first := models.NewMessage("first")
+	db.Create(first)
+
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+	assert.Equal(t, []string{"first"}, relay.delivered)
+
+	// failed deliveries are retried until max attempts
+	relay.fail = true
+	second := models.NewMessage("second")
+	db.Create(second)
+
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+
+	delivery := models.Delivery{}
+	db.Where(models.Delivery{Relay: "test", MessageID: second.ID}).First(&delivery)
+	assert.Equal(t, models.DeliveryFailed, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, "relay down", delivery.Error)
+
+	// deleted messages are retracted once
+	db.Delete(first)
+
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+	assert.Equal(t, []string{"remote-" + first.ID}, relay.retracted)
+
+	delivery = models.Delivery{}
+	db.Where(models.Delivery{Relay: "test", MessageID: first.ID}).First(&delivery)
+	assert.Equal(t, models.DeliveryRetracted, delivery.Status)
+
+	// failed retractions are retried until max attempts
+	relay.fail = false
+	relay.unretract = true
+	third := models.NewMessage("third")
+	db.Create(third)
+	require.NoError(t, poller.Poll(ctx))
+	db.Delete(third)
+
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+	require.NoError(t, poller.Poll(ctx))
+
+	delivery = models.Delivery{}
+	db.Where(models.Delivery{Relay: "test", MessageID: third.ID}).First(&delivery)
+	assert.Equal(t, models.DeliveryKept, delivery.Status)
+	assert.Equal(t, 2, delivery.RetractAttempts)
+	assert.Equal(t, "relay down", delivery.Error)
+}
+
+func TestPollerEvents(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	relay := &fakeRelay{name: "test"}
+
+	poller := NewPoller(db, relay)
+	poller.Interval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- poller.Run(ctx)
+	}()
+
+	message := models.NewMessage("queued")
+	db.Create(message)
+
+	dispatcher := &Dispatcher{}
+	dispatcher.Add(poller)
+	dispatcher.Dispatch(Event{Type: EventCreated, Message: message})
+
+	waitForStatus(t, db, message, models.DeliveryDelivered)
+
+	// relays without retraction keep the message
+	db.Delete(message)
+	dispatcher.Dispatch(Event{Type: EventDeleted, Message: message})
+
+	waitForStatus(t, db, message, models.DeliveryKept)
+
+	status := dispatcher.Status(ctx)
+	require.Len(t, status, 1)
+	assert.Equal(t, "test", status[0].Name)
+	assert.True(t, status[0].Healthy)
+	assert.Equal(t, 2, status[0].Delivered)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+// resumingRelay reaches only part of its targets on the first attempt
+type resumingRelay struct {
+	fakeRelay
+	resumed []string
+}
+
+func (f *resumingRelay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	return "first", errors.New("second down")
+}
+
+func (f *resumingRelay) Resume(ctx context.Context, message *models.Message, remoteID string) (string, error) {
+	f.resumed = append(f.resumed, remoteID)
+	return remoteID + ",second", nil
+}
+
+func TestPollerResume(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	relay := &resumingRelay{fakeRelay: fakeRelay{name: "test"}}
+	poller := NewPoller(db, relay)
+
+	ctx := context.Background()
+	message := models.NewMessage("Hackspace is open")
+	require.NoError(t, db.Create(message).Error)
+
+	// the partial delivery is recorded
+	require.NoError(t, poller.Handle(ctx, Event{Type: EventCreated, Message: message}))
+	delivery := models.Delivery{}
+	require.NoError(t, db.Where(models.Delivery{Relay: "test", MessageID: message.ID}).First(&delivery).Error)
+	assert.Equal(t, models.DeliveryFailed, delivery.Status)
+	assert.Equal(t, "first", delivery.RemoteID)
+
+	// and continued by the retry
+	require.NoError(t, poller.Handle(ctx, Event{Type: EventCreated, Message: message}))
+	require.NoError(t, db.Where(models.Delivery{Relay: "test", MessageID: message.ID}).First(&delivery).Error)
+	assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, "first,second", delivery.RemoteID)
+	assert.Equal(t, []string{"first"}, relay.resumed)
+}
+
+// start the dispatcher and wait until it runs
+func start(dispatcher *Dispatcher) {
+	go dispatcher.Run(context.Background())
+	for !dispatcher.running() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	relay := &fakeRelay{name: "test"}
+
+	poller := NewPoller(db, relay)
+	poller.Interval = time.Hour
+
+	dispatcher := &Dispatcher{}
+	dispatcher.Add(poller)
+
+	// queued events are delivered before the relay stops
+	for _, text := range []string{"first", "second", "third"} {
+		message := models.NewMessage(text)
+		db.Create(message)
+		dispatcher.Dispatch(Event{Type: EventCreated, Message: message})
+	}
+	poller.Since = time.Now()
+
+	start(dispatcher)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, dispatcher.Shutdown(ctx))
+	assert.Equal(t, []string{"first", "second", "third"}, relay.delivered)
+}
+
+func TestDispatcherShutdownTimeout(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	relay := &fakeRelay{name: "test", hang: true}
+
+	poller := NewPoller(db, relay)
+	poller.Interval = time.Hour
+
+	dispatcher := &Dispatcher{}
+	dispatcher.Add(poller)
+
+	message := models.NewMessage("stuck")
+	db.Create(message)
+	dispatcher.Dispatch(Event{Type: EventCreated, Message: message})
+	poller.Since = time.Now()
+
+	start(dispatcher)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// the hanging delivery is canceled
+	assert.Equal(t, context.DeadlineExceeded, dispatcher.Shutdown(ctx))
+	assert.NotPanics(t, func() {
+		dispatcher.Shutdown(ctx)
+	})
+}
+
+func TestDispatcherShutdownWithoutRun(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	dispatcher := &Dispatcher{}
+	dispatcher.Add(NewPoller(db, &fakeRelay{name: "test"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, dispatcher.Shutdown(ctx))
+	assert.NoError(t, dispatcher.Shutdown(ctx))
+}
+
+func TestRegistry(t *testing.T) {
+	Register("fake", func(ctx context.Context, cfg *config.Config, db *gorm.DB) (Relay, error) {
+		return &fakeRelay{name: "fake"}, nil
+	})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "fake")
+		registryMu.Unlock()
+	}()
+
+	assert.Contains(t, Names(), "fake")
+	assert.Panics(t, func() {
+		Register("fake", nil)
+	})
+
+	_, err := Open(context.Background(), "unknown", &config.Config{}, nil)
+	assert.Error(t, err)
+
+	poller, err := Open(context.Background(), "fake", &config.Config{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "fake", poller.Name())
+}
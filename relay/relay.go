@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// ErrNotSupported is returned by relays which can't retract or update a
+// posted copy, like irc or e-mail
+var ErrNotSupported = errors.New("not supported by relay")
+
+// Relay delivers messages to another service
+type Relay interface {
+	// Name is used for the registry and the recorded deliveries
+	Name() string
+
+	// Deliver posts the message and returns the id of the posted copy
+	Deliver(ctx context.Context, message *models.Message) (string, error)
+
+	// Retract removes the posted copy of a deleted message
+	Retract(ctx context.Context, message *models.Message, remoteID string) error
+
+	// Health checks if the service is reachable
+	Health(ctx context.Context) error
+}
+
+// Updater is implemented by relays which can edit a posted copy
+type Updater interface {
+	Update(ctx context.Context, message *models.Message, remoteID string) (string, error)
+}
+
+// Resumer is implemented by relays which continue a partial delivery. The
+// remote id returned with the error of a failed attempt is passed to the next
+// attempt instead of calling Deliver again.
+type Resumer interface {
+	Resume(ctx context.Context, message *models.Message, remoteID string) (string, error)
+}
+
+// Factory creates a relay, the context ends the lifetime of the relay
+type Factory func(ctx context.Context, config *config.Config, db *gorm.DB) (Relay, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a relay available by name, it is called in the init of the
+// relay packages
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic("relay: register called twice for " + name)
+	}
+
+	registry[name] = factory
+}
+
+// Names of all registered relays
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Open creates a registered relay and its poller with the configured interval
+func Open(ctx context.Context, name string, config *config.Config, db *gorm.DB) (*Poller, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("unknown relay %s", name)
+	}
+
+	relay, err := factory(ctx, config, db)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open relay %s", name)
+	}
+
+	poller := NewPoller(db, relay)
+	if config.Relay.PollInterval > 0 {
+		poller.Interval = time.Duration(config.Relay.PollInterval) * time.Second
+	}
+
+	return poller, nil
+}
+
+// EventType of a message change
+type EventType string
+
+// Message changes fed to the relays
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// Event is a change of a message
+type Event struct {
+	Type    EventType
+	Message *models.Message
+}
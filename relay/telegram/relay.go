@@ -0,0 +1,104 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/relay"
+)
+
+func init() {
+	relay.Register("telegram", open)
+}
+
+// Relay posts messages to chats and deletes them on deletion
+type Relay struct {
+	Client *Client
+
+	// Chats are chat ids or @channel usernames
+	Chats []string
+}
+
+// open checks the configured bot token
+func open(ctx context.Context, cfg *config.Config, db *gorm.DB) (relay.Relay, error) {
+	if cfg.Telegram.Token == "" || cfg.Telegram.Chats == "" {
+		return nil, errors.New("need TELEGRAM_TOKEN and TELEGRAM_CHATS env vars")
+	}
+
+	client := NewClient(cfg.Telegram.Endpoint, cfg.Telegram.Token, logrus.WithField("relay", "telegram"))
+
+	username, err := client.GetMe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.log.Infof("Logged in as @%s", username)
+
+	return &Relay{Client: client, Chats: config.List(cfg.Telegram.Chats)}, nil
+}
+
+// Name of the relay
+func (r *Relay) Name() string {
+	return "telegram"
+}
+
+// Health checks if the bot token is still valid
+func (r *Relay) Health(ctx context.Context) error {
+	_, err := r.Client.GetMe(ctx)
+	return err
+}
+
+// Deliver posts the message to all chats and returns the message ids per
+// chat. The bot api has no idempotency keys, so a partial delivery is rolled
+// back to not post twice on the next attempt.
+func (r *Relay) Deliver(ctx context.Context, message *models.Message) (string, error) {
+	posted := map[string]int64{}
+
+	for _, chat := range r.Chats {
+		messageID, err := r.Client.SendMessage(ctx, chat, message.Text)
+		if err != nil {
+			r.delete(ctx, posted)
+			return "", err
+		}
+
+		posted[chat] = messageID
+	}
+
+	data, err := json.Marshal(posted)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// Retract deletes the posted messages of a deleted message
+func (r *Relay) Retract(ctx context.Context, message *models.Message, remoteID string) error {
+	posted := map[string]int64{}
+	if err := json.Unmarshal([]byte(remoteID), &posted); err != nil {
+		return errors.Wrap(err, "bad remote id")
+	}
+
+	return r.delete(ctx, posted)
+}
+
+// delete posted messages and return the first error
+func (r *Relay) delete(ctx context.Context, posted map[string]int64) error {
+	var first error
+
+	for chat, messageID := range posted {
+		if err := r.Client.DeleteMessage(ctx, chat, messageID); err != nil {
+			r.Client.log.WithError(err).Warn("delete failed")
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
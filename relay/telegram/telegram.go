@@ -0,0 +1,198 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultEndpoint of the bot api
+const DefaultEndpoint = "https://api.telegram.org"
+
+// maxResponseSize of bot api responses
+const maxResponseSize = 1 << 20
+
+// Error returned by the bot api
+type Error struct {
+	Code        int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+// Client talks to the bot api
+type Client struct {
+	Endpoint string
+	Token    string
+
+	// MaxRetries on rate limits and server errors
+	MaxRetries int
+	// Backoff is the first delay between retries, it doubles every retry
+	Backoff time.Duration
+
+	http *http.Client
+	log  *logrus.Entry
+}
+
+// NewClient for a bot token
+func NewClient(endpoint string, token string, log *logrus.Entry) *Client {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	return &Client{
+		Endpoint:   strings.TrimSuffix(endpoint, "/"),
+		Token:      token,
+		MaxRetries: 5,
+		Backoff:    time.Second,
+		http:       &http.Client{Timeout: 30 * time.Second},
+		log:        log,
+	}
+}
+
+// GetMe checks the token and returns the username of the bot
+func (c *Client) GetMe(ctx context.Context) (string, error) {
+	var response struct {
+		Username string `json:"username"`
+	}
+	if err := c.do(ctx, "getMe", map[string]string{}, &response); err != nil {
+		return "", errors.Wrap(err, "get me")
+	}
+
+	return response.Username, nil
+}
+
+// SendMessage posts a text to a chat and returns the message id
+func (c *Client) SendMessage(ctx context.Context, chatID string, text string) (int64, error) {
+	request := map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}
+
+	var response struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := c.do(ctx, "sendMessage", request, &response); err != nil {
+		return 0, errors.Wrapf(err, "send to %s", chatID)
+	}
+
+	return response.MessageID, nil
+}
+
+// DeleteMessage of a chat, bots can only delete messages younger than 48 hours.
+// A message which is gone already counts as deleted, so a retry after a
+// partial failure succeeds.
+func (c *Client) DeleteMessage(ctx context.Context, chatID string, messageID int64) error {
+	request := map[string]interface{}{
+		"chat_id":    chatID,
+		"message_id": messageID,
+	}
+
+	err := c.do(ctx, "deleteMessage", request, nil)
+	if telegramErr, ok := err.(*Error); ok && telegramErr.Code == http.StatusBadRequest && strings.Contains(telegramErr.Description, "message to delete not found") {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "delete %d in %s", messageID, chatID)
+	}
+
+	return nil
+}
+
+// do a request and retry on rate limits and server errors
+func (c *Client) do(ctx context.Context, method string, request interface{}, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	delay := c.Backoff
+	for attempt := 0; ; attempt++ {
+		err := c.request(ctx, method, body, result)
+
+		telegramErr, ok := err.(*Error)
+		if !ok || attempt >= c.MaxRetries {
+			return err
+		}
+		if telegramErr.Code != http.StatusTooManyRequests && telegramErr.Code < http.StatusInternalServerError {
+			return err
+		}
+
+		wait := delay
+		if telegramErr.Parameters.RetryAfter > 0 {
+			wait = time.Duration(telegramErr.Parameters.RetryAfter) * time.Second
+		}
+		c.log.WithError(err).Warnf("retry in %s", wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+	}
+}
+
+// request calls a single bot api method
+func (c *Client) request(ctx context.Context, method string, body []byte, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+"/bot"+c.Token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		// the url contains the token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrap(err, method)
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Error
+		OK     bool            `json:"ok"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return &Error{Code: res.StatusCode, Description: http.StatusText(res.StatusCode)}
+	}
+
+	if !response.OK {
+		if response.Code == 0 {
+			response.Code = res.StatusCode
+		}
+		return &response.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
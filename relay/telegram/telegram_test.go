@@ -0,0 +1,138 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// fakeBotAPI records sent and deleted messages
+type fakeBotAPI struct {
+	sync.Mutex
+
+	nextID    int64
+	sent      map[string][]string
+	deleted   []int64
+	rateLimit int
+	down      string
+	// stuck fails the next delete of this message
+	stuck int64
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, "/bottoken/") {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 401, "description": "Unauthorized"})
+		return
+	}
+
+	var body struct {
+		ChatID    string `json:"chat_id"`
+		Text      string `json:"text"`
+		MessageID int64  `json:"message_id"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	switch strings.TrimPrefix(r.URL.Path, "/bottoken/") {
+	case "getMe":
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": map[string]string{"username": "moc_bot"}})
+	case "sendMessage":
+		if f.rateLimit > 0 {
+			f.rateLimit--
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 429, "description": "Too Many Requests"})
+			return
+		}
+		if body.ChatID == f.down {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"})
+			return
+		}
+
+		f.nextID++
+		f.sent[body.ChatID] = append(f.sent[body.ChatID], body.Text)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": map[string]int64{"message_id": f.nextID}})
+	case "deleteMessage":
+		if body.MessageID == f.stuck {
+			f.stuck = 0
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: message can't be deleted"})
+			return
+		}
+		for _, id := range f.deleted {
+			if id == body.MessageID {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: message to delete not found"})
+				return
+			}
+		}
+
+		f.deleted = append(f.deleted, body.MessageID)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": true})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 404, "description": "Not Found"})
+	}
+}
+
+func TestRelay(t *testing.T) {
+	bot := &fakeBotAPI{sent: map[string][]string{}, rateLimit: 2}
+	server := httptest.NewServer(bot)
+	defer server.Close()
+
+	ctx := context.Background()
+
+	client := NewClient(server.URL, "token", logrus.WithField("test", true))
+	client.Backoff = time.Millisecond
+
+	relay := &Relay{Client: client, Chats: []string{"-100", "@moc"}}
+	require.NoError(t, relay.Health(ctx))
+
+	message := models.NewMessage("Hackspace is open")
+
+	// rate limited requests are retried
+	remoteID, err := relay.Deliver(ctx, message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"-100":1,"@moc":2}`, remoteID)
+	assert.Equal(t, map[string][]string{"-100": {"Hackspace is open"}, "@moc": {"Hackspace is open"}}, bot.sent)
+
+	require.NoError(t, relay.Retract(ctx, message, remoteID))
+	assert.ElementsMatch(t, []int64{1, 2}, bot.deleted)
+
+	// partial deliveries are rolled back
+	bot.deleted = nil
+	bot.down = "@moc"
+	_, err = relay.Deliver(ctx, message)
+	assert.EqualError(t, err, "send to @moc: telegram: 400 Bad Request: chat not found")
+	assert.Equal(t, []int64{3}, bot.deleted)
+
+	// a retraction retried after a partial failure ends
+	bot.down = ""
+	remoteID, err = relay.Deliver(ctx, message)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"-100":4,"@moc":5}`, remoteID)
+
+	bot.deleted, bot.stuck = nil, 5
+	assert.Error(t, relay.Retract(ctx, message, remoteID))
+	assert.Equal(t, []int64{4}, bot.deleted)
+	require.NoError(t, relay.Retract(ctx, message, remoteID))
+	assert.ElementsMatch(t, []int64{4, 5}, bot.deleted)
+
+	// bad tokens are not retried
+	client.Token = "wrong"
+	assert.Error(t, relay.Health(ctx))
+}
@@ -4,21 +4,28 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"runtime/debug"
 
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
 	session "github.com/chaostreff-flensburg/moc/context"
+	"github.com/chaostreff-flensburg/moc/tracing"
 )
 
 // HTTPError is an error with a message and an HTTP status code.
 type HTTPError struct {
-	Object          string      `json:"object"`
-	Code            int         `json:"code"`
-	Message         string      `json:"msg"`
-	Json            interface{} `json:"json"`
-	InternalError   error       `json:"-"`
-	InternalMessage string      `json:"-"`
-	ErrorID         string      `json:"error_id,omitempty"`
+	Object          string            `json:"object"`
+	Code            int               `json:"code"`
+	Message         string            `json:"msg"`
+	Json            interface{}       `json:"json"`
+	InternalError   error             `json:"-"`
+	InternalMessage string            `json:"-"`
+	ErrorID         string            `json:"error_id,omitempty"`
+	ErrorCode       string            `json:"error_code,omitempty"`
+	Messages        map[string]string `json:"messages,omitempty"`
 }
 
 // ======================================
@@ -42,6 +49,20 @@ func NotFoundError(fmtString string, args ...interface{}) *HTTPError {
 	return httpError(http.StatusNotFound, fmtString, args...)
 }
 
+// ======================================
+// Return conflict error
+// ======================================
+func ConflictError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusConflict, fmtString, args...)
+}
+
+// ======================================
+// Return request entity too large error
+// ======================================
+func RequestEntityTooLargeError(fmtString string, args ...interface{}) *HTTPError {
+	return httpError(http.StatusRequestEntityTooLarge, fmtString, args...)
+}
+
 // ======================================
 // Return unauthorized error
 // ======================================
@@ -84,6 +105,14 @@ func (e *HTTPError) WithJsonError(json interface{}) *HTTPError {
 	return e
 }
 
+// ======================================
+// WithMessages adds readable messages to the rules in the json error
+// ======================================
+func (e *HTTPError) WithMessages(messages map[string]string) *HTTPError {
+	e.Messages = messages
+	return e
+}
+
 // ======================================
 // WithInternalError adds internal error information to the error
 // ======================================
@@ -100,43 +129,82 @@ func (e *HTTPError) WithInternalMessage(fmtString string, args ...interface{}) *
 	return e
 }
 
+// ======================================
+// WithCode sets the stable error code of the failure
+// ======================================
+func (e *HTTPError) WithCode(code string) *HTTPError {
+	e.ErrorCode = code
+	return e
+}
+
+// defaultCodes of errors without a specific code
+var defaultCodes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusConflict:            CodeConflict,
+	http.StatusInternalServerError: CodeInternal,
+	http.StatusServiceUnavailable:  CodeServiceUnavailable,
+}
+
 func httpError(code int, fmtString string, args ...interface{}) *HTTPError {
 	return &HTTPError{
-		Object:  "error",
-		Code:    code,
-		Message: fmt.Sprintf(fmtString, args...),
+		Object:    "error",
+		Code:      code,
+		Message:   fmt.Sprintf(fmtString, args...),
+		ErrorCode: defaultCodes[code],
 	}
 }
 
+// panics recovered by the Recoverer, the global meter provider hands the
+// counter to the exporter once it is set up
+var panics, _ = tracing.Meter().Int64Counter("moc.http.server.panics",
+	metric.WithDescription("Panics recovered from the handlers"),
+	metric.WithUnit("{panic}"),
+)
+
 // ======================================
-// Recoverer is a middleware that recovers from panics, logs the panic (and a
-// backtrace), and returns a HTTP 500 (Internal Server Error) status if
-// possible. Recoverer prints a request ID if one is provided.
+// Recoverer is a middleware that recovers from panics of the next handlers,
+// logs the panic with a backtrace, records it on the trace of the request,
+// counts it in the metric moc.http.server.panics and returns a HTTP 500 (Internal Server Error) with the request id as error_id.
+// It needs the logger and the request id in the context.
 // ======================================
-func Recoverer(w http.ResponseWriter, r *http.Request) (context.Context, error) {
-	ctx := r.Context()
-
-	defer func() {
-		if rvr := recover(); rvr != nil {
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
 
-			log := session.GetLogger(ctx)
-			if log != nil {
-				log.Panic(rvr, debug.Stack())
-			} else {
-				fmt.Fprintf(os.Stderr, "Panic: %+v\n", rvr)
-				debug.PrintStack()
+			// the server aborts the response on purpose
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
 			}
 
-			se := &HTTPError{
-				Object:  "error",
-				Code:    http.StatusInternalServerError,
-				Message: http.StatusText(http.StatusInternalServerError),
+			stack := debug.Stack()
+			err, ok := rvr.(error)
+			if !ok {
+				err = fmt.Errorf("%v", rvr)
 			}
-			handleError(se, w, r)
-		}
-	}()
 
-	return nil, nil
+			span := trace.SpanFromContext(r.Context())
+			span.RecordError(err, trace.WithAttributes(
+				semconv.ExceptionType("panic"),
+				semconv.ExceptionStacktrace(string(stack)),
+			))
+			span.SetStatus(codes.Error, "panic")
+			panics.Add(r.Context(), 1, metric.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method)))
+
+			// the error is logged once with the backtrace
+			log := session.GetLogger(r.Context()).WithField("stack", string(stack))
+			r = r.WithContext(context.WithValue(r.Context(), "log", log))
+
+			handleError(InternalServerError(http.StatusText(http.StatusInternalServerError)).WithInternalError(err).WithInternalMessage("panic: %v", rvr), w, r)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
 }
 
 // ======================================
@@ -147,24 +215,30 @@ func handleError(err error, w http.ResponseWriter, r *http.Request) {
 
 	log := session.GetLogger(ctx)
 	errorID := session.GetRequestID(r.Context())
-	switch e := err.(type) {
-	case *HTTPError:
-		if e.Code >= http.StatusInternalServerError {
-			e.ErrorID = *errorID
-			// this will get us the stack trace too
-			log.WithError(e.Cause()).Error(e.Error())
-		} else {
-			log.WithError(e.Cause()).Info(e.Error())
-		}
-		if jsonErr := SendJSON(w, e.Code, e); jsonErr != nil {
-			handleError(jsonErr, w, r)
-		}
-	default:
-		log.WithError(e).Errorf("Unhandled server error: %s", e.Error())
+
+	e, ok := err.(*HTTPError)
+	if !ok {
+		log.WithError(err).Errorf("Unhandled server error: %s", err.Error())
 		// hide real error details from response to prevent info leaks
-		w.WriteHeader(http.StatusInternalServerError)
-		if _, writeErr := w.Write([]byte(`{object:"error",code":500,"msg":"Internal server error","error_id":"` + *errorID + `"}`)); writeErr != nil {
-			log.WithError(writeErr).Error("Error writing generic error message")
-		}
+		e = InternalServerError("Internal server error")
+	} else if e.Code >= http.StatusInternalServerError {
+		// this will get us the stack trace too
+		log.WithError(e.Cause()).Error(e.Error())
+	} else {
+		log.WithError(e.Cause()).Info(e.Error())
+	}
+
+	if e.Code >= http.StatusInternalServerError && errorID != nil {
+		e.ErrorID = *errorID
+	}
+
+	var jsonErr error
+	if acceptsProblem(r) {
+		jsonErr = SendJSONWithContentType(w, e.Code, ProblemContentType, e.Problem(r))
+	} else {
+		jsonErr = SendJSON(w, e.Code, e)
+	}
+	if jsonErr != nil {
+		log.WithError(jsonErr).Error("Error writing error response")
 	}
 }
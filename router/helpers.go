@@ -13,11 +13,11 @@ import (
 func HandleSQLError(err error) error {
 	if mysqlError, ok := err.(*mysql.MySQLError); ok {
 		if mysqlError.Number == 1062 {
-			return BadRequestError("duplicate slug").WithInternalError(mysqlError)
+			return BadRequestError("duplicate slug").WithCode(CodeDuplicate).WithInternalError(mysqlError)
 		}
 	} else if sqliteError, ok := err.(sqlite3.Error); ok {
 		if sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique {
-			return BadRequestError("duplicate slug").WithInternalError(mysqlError)
+			return BadRequestError("duplicate slug").WithCode(CodeDuplicate).WithInternalError(sqliteError)
 		}
 	}
 
@@ -25,7 +25,11 @@ func HandleSQLError(err error) error {
 }
 
 func SendJSON(w http.ResponseWriter, status int, obj interface{}) error {
-	w.Header().Set("Content-Type", "application/json")
+	return SendJSONWithContentType(w, status, "application/json", obj)
+}
+
+func SendJSONWithContentType(w http.ResponseWriter, status int, contentType string, obj interface{}) error {
+	w.Header().Set("Content-Type", contentType)
 	b, err := json.Marshal(obj)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error encoding json response: %v", obj))
@@ -0,0 +1,126 @@
+package router
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProblemContentType of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Error codes are stable, clients may rely on them instead of the message
+const (
+	CodeInvalidRequest   = "request.invalid"
+	CodeInvalidPayload   = "request.invalid_payload"
+	CodeInvalidParameter = "request.invalid_parameter"
+	CodeDuplicate        = "request.duplicate"
+	CodeConflict         = "request.conflict"
+	CodeTooLarge         = "request.too_large"
+
+	CodeUnauthorized = "auth.unauthorized"
+	CodeNotFound     = "resource.not_found"
+
+	CodeMessageNotFound        = "message.not_found"
+	CodeSubscriberNotFound     = "subscriber.not_found"
+	CodeSubscriberInvalidToken = "subscriber.invalid_token"
+	CodeTemplateNotFound       = "template.not_found"
+	CodeScheduleNotFound       = "schedule.not_found"
+
+	CodeArchiveInvalid  = "archive.invalid"
+	CodeArchiveConflict = "archive.conflict"
+
+	CodeActivityPubBadSignature     = "activitypub.bad_signature"
+	CodeActivityPubActorMismatch    = "activitypub.actor_mismatch"
+	CodeActivityPubUnknownObject    = "activitypub.unknown_object"
+	CodeActivityPubActorUnavailable = "activitypub.actor_unavailable"
+
+	CodeDatabaseUnreachable = "database.unreachable"
+	CodeMigrationPending    = "database.migration_pending"
+	CodeServiceUnavailable  = "service.unavailable"
+
+	CodeStreamingUnsupported = "stream.unsupported"
+	CodeInternal             = "internal.error"
+)
+
+// Problem is an error response of RFC 7807
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	ErrorID       string         `json:"error_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam names a field of the request and the rule it breaks
+type InvalidParam struct {
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// ProblemType is the type uri of an error code
+func ProblemType(code string) string {
+	return "urn:moc:error:" + code
+}
+
+// Problem of the error for the request
+func (e *HTTPError) Problem(r *http.Request) *Problem {
+	return &Problem{
+		Type:          ProblemType(e.ErrorCode),
+		Title:         http.StatusText(e.Code),
+		Status:        e.Code,
+		Detail:        e.Message,
+		Instance:      r.URL.Path,
+		Code:          e.ErrorCode,
+		ErrorID:       e.ErrorID,
+		InvalidParams: invalidParams(e.Json, e.Messages),
+	}
+}
+
+// invalidParams of validation errors, which map a field to a rule
+func invalidParams(json interface{}, messages map[string]string) []InvalidParam {
+	value := reflect.ValueOf(json)
+	if value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+
+	params := []InvalidParam{}
+	for _, key := range value.MapKeys() {
+		params = append(params, InvalidParam{
+			Name:    key.String(),
+			Reason:  fmt.Sprint(value.MapIndex(key).Interface()),
+			Message: messages[key.String()],
+		})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+
+	return params
+}
+
+// acceptsProblem checks if the client asks for problem+json, the plain json
+// errors stay the default for old clients
+func acceptsProblem(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || mediaType != ProblemContentType {
+			continue
+		}
+
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		return true
+	}
+
+	return false
+}
@@ -62,6 +62,32 @@ func (r *Router) UseBypass(fn func(next http.Handler) http.Handler) {
 	r.chi.Use(fn)
 }
 
+// ======================================
+// Walk all routes
+// ======================================
+func (r *Router) Walk(fn func(method string, route string) error) error {
+	return chi.Walk(r.chi, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		return fn(method, route)
+	})
+}
+
+// ======================================
+// Match a route without serving it
+// ======================================
+func (r *Router) Match(method string, path string) (string, map[string]string, bool) {
+	rctx := chi.NewRouteContext()
+	if !r.chi.Match(rctx, method, path) {
+		return "", nil, false
+	}
+
+	params := map[string]string{}
+	for i, key := range rctx.URLParams.Keys {
+		params[key] = rctx.URLParams.Values[i]
+	}
+
+	return rctx.RoutePattern(), params, true
+}
+
 // ======================================
 // Serve
 // ======================================
@@ -0,0 +1,172 @@
+// Package schedule turns the due occurrences of the recurring schedules into
+// messages.
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chaostreff-flensburg/moc/models"
+)
+
+// DefaultInterval between two checks for due schedules
+const DefaultInterval = 5 * time.Second
+
+// DefaultGrace is how late an occurrence is still sent, older ones were
+// missed while moc was down and are skipped
+const DefaultGrace = 5 * time.Minute
+
+// Scheduler checks the schedules in the interval. An occurrence is claimed
+// by moving next_run_at in the same transaction which creates the message,
+// so it fires once even across restarts or with several instances.
+type Scheduler struct {
+	Interval time.Duration
+	Grace    time.Duration
+
+	// OnCreate is called with every created message
+	OnCreate func(message *models.Message)
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	db  *gorm.DB
+	log *logrus.Entry
+}
+
+// NewScheduler creates a scheduler of the schedules in a database
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{
+		Interval: DefaultInterval,
+		Grace:    DefaultGrace,
+		OnCreate: func(message *models.Message) {},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		db:       db,
+		log:      logrus.WithField("component", "scheduler"),
+	}
+}
+
+// Run checks for due schedules until the context is canceled or the
+// scheduler is shut down
+func (s *Scheduler) Run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Fire(time.Now()); err != nil {
+			s.log.WithError(err).Error("schedules failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown stops the scheduler and waits for a running check
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fire all schedules due at a time
+func (s *Scheduler) Fire(now time.Time) error {
+	schedules := []*models.Schedule{}
+	if err := s.db.Where("paused = ? AND next_run_at <= ?", false, now.UTC()).Find(&schedules).Error; err != nil {
+		return errors.Wrap(err, "load schedules")
+	}
+
+	for _, schedule := range schedules {
+		message, err := s.fire(schedule, now)
+		if err != nil {
+			s.log.WithError(err).WithField("schedule", schedule.ID).Error("schedule failed")
+			continue
+		}
+
+		if message != nil {
+			s.log.WithField("schedule", schedule.ID).WithField("message", message.ID).Info("Scheduled message created")
+			s.OnCreate(message)
+		}
+	}
+
+	return nil
+}
+
+// fire the due occurrence of a schedule, the message is nil if another
+// instance claimed the occurrence or it was missed
+func (s *Scheduler) fire(schedule *models.Schedule, now time.Time) (*models.Message, error) {
+	claimed := *schedule.NextRunAt
+	occurrence := claimed
+
+	next, err := schedule.Next(occurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	// after a downtime only the latest occurrence within the grace is sent
+	for occurrence.Before(now.Add(-s.Grace)) && next != nil && !next.After(now) {
+		occurrence = *next
+		if next, err = schedule.Next(occurrence); err != nil {
+			return nil, err
+		}
+	}
+	missed := occurrence.Before(now.Add(-s.Grace))
+
+	columns := map[string]interface{}{"last_run_at": occurrence, "next_run_at": gorm.Expr("NULL")}
+	if next != nil {
+		columns["next_run_at"] = *next
+	}
+
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	res := tx.Model(&models.Schedule{}).Where("id = ? AND next_run_at = ?", schedule.ID, claimed).UpdateColumns(columns)
+	if res.Error != nil {
+		tx.Rollback()
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	var message *models.Message
+	if missed {
+		s.log.WithField("schedule", schedule.ID).Warnf("Skipped occurrence %s, it was missed", occurrence.Format(time.RFC3339))
+	} else {
+		message = models.NewMessage(schedule.Text)
+		message.ScheduleID = &schedule.ID
+		if err := tx.Create(message).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
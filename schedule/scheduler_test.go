@@ -0,0 +1,135 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chaostreff-flensburg/moc/models"
+	"github.com/chaostreff-flensburg/moc/models/modelstest"
+)
+
+// nightly schedule at 23:30 in Berlin, planned from a time
+func nightly(t *testing.T, db *gorm.DB, from time.Time) *models.Schedule {
+	schedule := &models.Schedule{ScheduleRequest: models.ScheduleRequest{
+		MessageRequest: models.MessageRequest{Text: "Hackspace closes in 30 minutes"},
+		Cron:           "30 23 * * *",
+		TimeZone:       "Europe/Berlin",
+	}}
+
+	next, err := schedule.Next(from)
+	require.NoError(t, err)
+	schedule.NextRunAt = next
+	require.NoError(t, db.Create(schedule).Error)
+
+	return schedule
+}
+
+func messages(t *testing.T, db *gorm.DB) []*models.Message {
+	messages := []*models.Message{}
+	require.NoError(t, db.Order("created_at").Find(&messages).Error)
+
+	return messages
+}
+
+func TestFire(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	start := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	schedule := nightly(t, db, start)
+	assert.Equal(t, time.Date(2019, 5, 1, 21, 30, 0, 0, time.UTC), *schedule.NextRunAt)
+
+	created := []*models.Message{}
+	scheduler := NewScheduler(db)
+	scheduler.OnCreate = func(message *models.Message) {
+		created = append(created, message)
+	}
+
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 1, 21, 29, 59, 0, time.UTC)))
+	assert.Empty(t, created)
+
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 1, 21, 30, 3, 0, time.UTC)))
+	require.Len(t, created, 1)
+	assert.Equal(t, "Hackspace closes in 30 minutes", created[0].Text)
+	assert.Equal(t, schedule.ID, *created[0].ScheduleID)
+
+	// a second check or instance finds nothing due
+	require.NoError(t, NewScheduler(db).Fire(time.Date(2019, 5, 1, 21, 30, 6, 0, time.UTC)))
+	assert.Len(t, messages(t, db), 1)
+
+	require.NoError(t, db.First(schedule, "id = ?", schedule.ID).Error)
+	assert.True(t, time.Date(2019, 5, 1, 21, 30, 0, 0, time.UTC).Equal(*schedule.LastRunAt))
+	assert.True(t, time.Date(2019, 5, 2, 21, 30, 0, 0, time.UTC).Equal(*schedule.NextRunAt))
+}
+
+func TestFireClaimed(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	schedule := nightly(t, db, time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	// two instances loaded the schedule, only the first claims it
+	now := time.Date(2019, 5, 1, 21, 30, 0, 0, time.UTC)
+	scheduler := NewScheduler(db)
+	message, err := scheduler.fire(schedule, now)
+	require.NoError(t, err)
+	assert.NotNil(t, message)
+
+	message, err = scheduler.fire(schedule, now)
+	require.NoError(t, err)
+	assert.Nil(t, message)
+
+	assert.Len(t, messages(t, db), 1)
+}
+
+func TestFireMissed(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	schedule := nightly(t, db, time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	// down for three days, the last occurrence is within the grace
+	scheduler := NewScheduler(db)
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 4, 21, 33, 0, 0, time.UTC)))
+	assert.Len(t, messages(t, db), 1)
+
+	// down for another day, the occurrence is too late
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 5, 23, 0, 0, 0, time.UTC)))
+	assert.Len(t, messages(t, db), 1)
+
+	require.NoError(t, db.First(schedule, "id = ?", schedule.ID).Error)
+	assert.True(t, time.Date(2019, 5, 6, 21, 30, 0, 0, time.UTC).Equal(*schedule.NextRunAt))
+}
+
+func TestFireEnd(t *testing.T) {
+	db, cleanup := modelstest.TempDB(t)
+	defer cleanup()
+
+	end := time.Date(2019, 5, 2, 0, 0, 0, 0, time.UTC)
+	schedule := &models.Schedule{ScheduleRequest: models.ScheduleRequest{
+		MessageRequest: models.MessageRequest{Text: "Talks start in 10 minutes"},
+		Cron:           "50 9 * * *",
+		EndAt:          &end,
+	}}
+	schedule.NextRunAt, _ = schedule.Next(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, db.Create(schedule).Error)
+
+	paused := nightly(t, db, time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, db.Model(paused).Update("paused", true).Error)
+
+	scheduler := NewScheduler(db)
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 1, 9, 50, 2, 0, time.UTC)))
+	require.Len(t, messages(t, db), 1)
+
+	require.NoError(t, db.First(schedule, "id = ?", schedule.ID).Error)
+	assert.Nil(t, schedule.NextRunAt)
+
+	// the ended and the paused schedule stay silent
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 1, 21, 30, 0, 0, time.UTC)))
+	require.NoError(t, scheduler.Fire(time.Date(2019, 5, 2, 9, 50, 0, 0, time.UTC)))
+	assert.Len(t, messages(t, db), 1)
+}
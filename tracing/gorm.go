@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// gorm settings of the span and its parent
+const (
+	contextKey = "tracing:context"
+	spanKey    = "tracing:span"
+)
+
+// WithContext traces the queries of the returned db as children of the span
+// in the context
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextKey, ctx)
+}
+
+// Instrument adds a span for every query of a db with a context, queries
+// without a context like the ones of the relays are not traced
+func Instrument(db *gorm.DB) {
+	callback := db.Callback()
+
+	callback.Create().Before("gorm:create").Register("tracing:before_create", before("create"))
+	callback.Create().After("gorm:create").Register("tracing:after_create", after)
+	callback.Query().Before("gorm:query").Register("tracing:before_query", before("query"))
+	callback.Query().After("gorm:query").Register("tracing:after_query", after)
+	callback.Update().Before("gorm:update").Register("tracing:before_update", before("update"))
+	callback.Update().After("gorm:update").Register("tracing:after_update", after)
+	callback.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete"))
+	callback.Delete().After("gorm:delete").Register("tracing:after_delete", after)
+	callback.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", before("row_query"))
+	callback.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", after)
+}
+
+// before starts the span of a query
+func before(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(contextKey)
+		if !ok {
+			return
+		}
+		ctx, ok := value.(context.Context)
+		if !ok {
+			return
+		}
+
+		table := scope.TableName()
+		_, span := Tracer().Start(ctx, "gorm."+operation+" "+table,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemNameKey.String(scope.Dialect().GetName()),
+				semconv.DBOperationName(operation),
+				semconv.DBCollectionName(table),
+			),
+		)
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+// after ends the span of a query with the statement and the error
+func after(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(semconv.DBQueryText(scope.SQL))
+
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,108 @@
+// Package tracing exports the spans and metrics of moc with opentelemetry
+package tracing
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/chaostreff-flensburg/moc/config"
+	"github.com/chaostreff-flensburg/moc/version"
+)
+
+// instrumentation name of the spans and metrics of moc
+const instrumentation = "github.com/chaostreff-flensburg/moc"
+
+func init() {
+	// the w3c trace context is passed on even if tracing is disabled
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Tracer of moc, it uses the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Meter of moc, it uses the global provider
+func Meter() metric.Meter {
+	return otel.Meter(instrumentation)
+}
+
+// Setup installs the exporters of the config as global providers, shutdown
+// exports the spans and metrics still buffered
+func Setup(ctx context.Context, cfg *config.Config) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	var metricExporter sdkmetric.Exporter
+
+	switch cfg.Tracing.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		options := []otlptracehttp.Option{}
+		if cfg.Tracing.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(signalURL(cfg.Tracing.Endpoint, "traces")))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+		if err == nil {
+			metricOptions := []otlpmetrichttp.Option{}
+			if cfg.Tracing.Endpoint != "" {
+				metricOptions = append(metricOptions, otlpmetrichttp.WithEndpointURL(signalURL(cfg.Tracing.Endpoint, "metrics")))
+			}
+			metricExporter, err = otlpmetrichttp.New(ctx, metricOptions...)
+		}
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err == nil {
+			metricExporter, err = stdoutmetric.New(stdoutmetric.WithWriter(os.Stdout))
+		}
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %s", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "create tracing exporter")
+	}
+
+	res := resource.NewSchemaless(
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+		semconv.ServiceVersion(version.Version),
+	)
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(meterProvider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if metricErr := meterProvider.Shutdown(ctx); err == nil {
+			err = metricErr
+		}
+		return err
+	}, nil
+}
+
+// signalURL below an otlp endpoint like http://localhost:4318
+func signalURL(endpoint string, signal string) string {
+	return strings.TrimRight(endpoint, "/") + "/v1/" + signal
+}
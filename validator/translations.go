@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+)
+
+// messages of the validation rules per locale, {0} is the field and {1} the
+// limit of min and max. Rules of numbers have the suffix _number.
+var messages = map[string]map[string]string{
+	"en": {
+		"required":    "{0} is required",
+		"min":         "{0} must be at least {1} characters long",
+		"max":         "{0} must be at most {1} characters long",
+		"min_number":  "{0} must be {1} or greater",
+		"max_number":  "{0} must be {1} or less",
+		"type":        "{0} has the wrong type",
+		"json":        "{0} is no valid json",
+		"email":       "{0} must be a valid email address",
+		"uuid":        "{0} must be a valid uuid",
+		"date-time":   "{0} must be a time like 2019-05-01T00:00:00Z",
+		"template":    "{0} has a broken variable, literal braces are doubled",
+		"cron":        "{0} must be a cron expression like 30 23 * * *",
+		"time_zone":   "{0} must be a time zone like Europe/Berlin",
+		"after_start": "{0} must be after start_at",
+		"invalid":     "{0} is invalid",
+	},
+	"de": {
+		"required":    "{0} ist erforderlich",
+		"min":         "{0} muss mindestens {1} Zeichen lang sein",
+		"max":         "{0} darf höchstens {1} Zeichen lang sein",
+		"min_number":  "{0} muss mindestens {1} sein",
+		"max_number":  "{0} darf höchstens {1} sein",
+		"type":        "{0} hat den falschen Typ",
+		"json":        "{0} ist kein gültiges json",
+		"email":       "{0} muss eine gültige E-Mail-Adresse sein",
+		"uuid":        "{0} muss eine gültige uuid sein",
+		"date-time":   "{0} muss eine Zeit wie 2019-05-01T00:00:00Z sein",
+		"template":    "{0} enthält eine fehlerhafte Variable, einfache Klammern werden verdoppelt",
+		"cron":        "{0} muss ein Cron-Ausdruck wie 30 23 * * * sein",
+		"time_zone":   "{0} muss eine Zeitzone wie Europe/Berlin sein",
+		"after_start": "{0} muss nach start_at liegen",
+		"invalid":     "{0} ist ungültig",
+	},
+}
+
+// translator holds the messages of all locales, english is the fallback
+var translator = newTranslator()
+
+func newTranslator() *ut.UniversalTranslator {
+	english := en.New()
+	uni := ut.New(english, english, de.New())
+
+	for locale, texts := range messages {
+		trans, _ := uni.GetTranslator(locale)
+		for rule, text := range texts {
+			if err := trans.Add(rule, text, false); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	return uni
+}
+
+// Translator for the preferred language of an Accept-Language header
+func Translator(acceptLanguage string) ut.Translator {
+	trans, _ := translator.FindTranslator(languages(acceptLanguage)...)
+	return trans
+}
+
+// Message describes a violated rule of a field, limit is the parameter of
+// rules like min
+func Message(trans ut.Translator, field string, rule string, limit string) string {
+	if _, ok := messages["en"][rule]; !ok {
+		rule = "invalid"
+	}
+
+	message, err := trans.T(rule, field, limit)
+	if err != nil {
+		return field + ": " + rule
+	}
+
+	return message
+}
+
+// languages of an Accept-Language header ordered by quality, like de_DE and
+// de for de-DE
+func languages(acceptLanguage string) []string {
+	type language struct {
+		locale  string
+		quality float64
+	}
+
+	accepted := []language{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		tag := strings.Replace(strings.TrimSpace(fields[0]), "-", "_", -1)
+		if tag == "" || tag == "*" || quality <= 0 {
+			continue
+		}
+
+		accepted = append(accepted, language{tag, quality})
+		if i := strings.Index(tag, "_"); i > 0 {
+			accepted = append(accepted, language{tag[:i], quality})
+		}
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].quality > accepted[j].quality
+	})
+
+	locales := make([]string, 0, len(accepted))
+	for _, language := range accepted {
+		locales = append(locales, language.locale)
+	}
+
+	return locales
+}
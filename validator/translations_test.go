@@ -0,0 +1,33 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"de_DE", "de", "en"}, languages("de-DE, en;q=0.8"))
+	assert.Equal(t, []string{"en", "de"}, languages("de;q=0.5, en, *;q=0.1"))
+	assert.Equal(t, []string{}, languages(""))
+}
+
+func TestMessage(t *testing.T) {
+	testCases := []struct {
+		acceptLanguage string
+		rule           string
+		limit          string
+		expected       string
+	}{
+		{"de-DE,de;q=0.9", "min", "3", "message muss mindestens 3 Zeichen lang sein"},
+		{"fr, de;q=0.5", "required", "", "message ist erforderlich"},
+		{"en-US", "max_number", "100", "message must be 100 or less"},
+		{"fr", "required", "", "message is required"},
+		{"", "pattern", "", "message is invalid"},
+	}
+
+	for _, testCase := range testCases {
+		trans := Translator(testCase.acceptLanguage)
+		assert.Equal(t, testCase.expected, Message(trans, "message", testCase.rule, testCase.limit), testCase.acceptLanguage)
+	}
+}
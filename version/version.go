@@ -0,0 +1,30 @@
+// Package version describes the build, the values are set by the linker:
+//
+//	go build -ldflags "-X github.com/chaostreff-flensburg/moc/version.Version=1.2.0 -X github.com/chaostreff-flensburg/moc/version.Commit=$(git rev-parse HEAD)"
+package version
+
+import "runtime"
+
+var (
+	// Version of the release
+	Version = "dev"
+
+	// Commit the release is built from
+	Commit = "unknown"
+)
+
+// Info about the build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get the info of the running build
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+	}
+}